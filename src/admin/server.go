@@ -0,0 +1,196 @@
+package admin
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/SongZihuan/ssh-watcher/src/config"
+	"github.com/SongZihuan/ssh-watcher/src/logger"
+	"github.com/SongZihuan/ssh-watcher/src/sshserver"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	StatusReady int32 = iota
+	StatusRunning
+	StatusStopping
+	StatusFinished
+)
+
+// ListenerName 升级时传递给新进程的管理接口监听的名称（转发名称不允许以 @ 开头）
+const ListenerName = "@admin"
+
+// Target 管理接口操作的会话
+type Target interface {
+	Sessions() []sshserver.SessionInfo
+	Kill(id uint, ip net.IP, note string) []sshserver.SessionInfo
+}
+
+// Server 管理接口的 HTTP 服务：查看正在进行的会话，按连接记录 ID 或来源IP断开会话
+type Server struct {
+	status atomic.Int32
+	target Target
+	token  string
+	ln     net.Listener
+	server *http.Server
+	swg    sync.WaitGroup
+}
+
+// NewServer 创建管理接口服务，inherited 为升级时旧进程传入的监听，可以为 nil
+func NewServer(target Target, inherited net.Listener) (*Server, error) {
+	if !config.IsReady() {
+		panic("config is not ready")
+	}
+
+	cfg := config.GetConfig().Admin
+
+	ln := inherited
+	if ln == nil {
+		var err error
+		ln, err = net.Listen("tcp", cfg.Address)
+		if err != nil {
+			return nil, fmt.Errorf("admin listen on %s failed: %s", cfg.Address, err.Error())
+		}
+	}
+
+	res := &Server{
+		target: target,
+		token:  cfg.Token,
+		ln:     ln,
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/sessions", res.auth(res.sessions))
+	mux.HandleFunc("/sessions/kill", res.auth(res.kill))
+
+	res.server = &http.Server{
+		Handler:           mux,
+		ReadHeaderTimeout: 5 * time.Second,
+	}
+
+	res.status.Store(StatusReady)
+
+	return res, nil
+}
+
+func (s *Server) Start() error {
+	if s.status.Load() != StatusReady {
+		return nil
+	}
+
+	s.swg.Add(1)
+	go func() {
+		defer s.swg.Done()
+
+		logger.Infof("admin listen on %s start", s.ln.Addr().String())
+		err := s.server.Serve(s.ln)
+		if err != nil && !errors.Is(err, http.ErrServerClosed) {
+			logger.Errorf("admin server error: %s", err.Error())
+		}
+		logger.Infof("admin listen on %s stop", s.ln.Addr().String())
+	}()
+
+	if !s.status.CompareAndSwap(StatusReady, StatusRunning) {
+		return fmt.Errorf("status error")
+	}
+
+	return nil
+}
+
+// Listener 正在使用的监听，用于升级时传给新进程
+func (s *Server) Listener() net.Listener {
+	return s.ln
+}
+
+func (s *Server) Stop() error {
+	if !s.status.CompareAndSwap(StatusRunning, StatusStopping) {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	_ = s.server.Shutdown(ctx)
+	s.swg.Wait()
+
+	s.status.CompareAndSwap(StatusStopping, StatusFinished)
+	return nil
+}
+
+func (s *Server) auth(next http.HandlerFunc) http.HandlerFunc {
+	want := []byte("Bearer " + s.token)
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		if subtle.ConstantTimeCompare([]byte(r.Header.Get("Authorization")), want) != 1 {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		next(w, r)
+	}
+}
+
+// sessions GET /sessions 列出所有转发正在进行的会话
+func (s *Server) sessions(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	writeJSON(w, s.target.Sessions())
+}
+
+// kill POST /sessions/kill?id=<记录ID> 或 ?ip=<来源IP>，可选 note 写入断开原因，返回被断开的会话
+func (s *Server) kill(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	idStr := r.FormValue("id")
+	ipStr := r.FormValue("ip")
+	note := r.FormValue("note")
+
+	var id uint64
+	var ip net.IP
+
+	if idStr != "" && ipStr != "" {
+		http.Error(w, "only one of id and ip is allowed", http.StatusBadRequest)
+		return
+	} else if idStr != "" {
+		var err error
+		id, err = strconv.ParseUint(idStr, 10, 64)
+		if err != nil || id == 0 {
+			http.Error(w, "bad id", http.StatusBadRequest)
+			return
+		}
+	} else if ipStr != "" {
+		ip = net.ParseIP(ipStr)
+		if ip == nil {
+			http.Error(w, "bad ip", http.StatusBadRequest)
+			return
+		}
+	} else {
+		http.Error(w, "id or ip is required", http.StatusBadRequest)
+		return
+	}
+
+	killed := s.target.Kill(uint(id), ip, note)
+	for _, sess := range killed {
+		logger.Warnf("admin kill session %d of forward %s from %s", sess.ID, sess.Forward, sess.From)
+	}
+
+	writeJSON(w, killed)
+}
+
+func writeJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	_ = json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,32 @@
+package config
+
+import (
+	"fmt"
+	"net"
+)
+
+type AdminConfig struct {
+	Address string `yaml:"address"` // 管理接口的 HTTP 监听地址，例如 127.0.0.1:9274，为空表示不启用
+	Token   string `yaml:"token"`   // 访问管理接口时需要的令牌（Authorization: Bearer <token>）
+}
+
+func (a *AdminConfig) setDefault() {
+	return
+}
+
+func (a *AdminConfig) check() (err ConfigError) {
+	if a.Address == "" {
+		return nil
+	}
+
+	_, _, splitErr := net.SplitHostPort(a.Address)
+	if splitErr != nil {
+		return NewConfigError(fmt.Sprintf("bad admin address: %s", splitErr.Error()))
+	}
+
+	if a.Token == "" {
+		return NewConfigError("admin token must be set when admin is enabled")
+	}
+
+	return nil
+}
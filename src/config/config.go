@@ -42,7 +42,7 @@ func newConfig(configPath string) (*ConfigStruct, error) {
 		// Lock不用初始化
 		configReady:    false,
 		yamlHasParser:  false,
-		sigchan:        make(chan os.Signal),
+		sigchan:        make(chan os.Signal, 4), // 重载配置时也要能接收退出信号
 		configPath:     configPath,
 		configDir:      configDir,
 		configFileName: configFileName,
@@ -84,6 +84,9 @@ func (c *ConfigStruct) Reload() (err ConfigError) {
 		return c.Init()
 	}
 
+	c.ConfigLock.Lock()
+	defer c.ConfigLock.Unlock()
+
 	bak := ConfigStruct{
 		configReady:    c.configReady,
 		yamlHasParser:  c.yamlHasParser,
@@ -95,24 +98,19 @@ func (c *ConfigStruct) Reload() (err ConfigError) {
 		// 新建类型
 	}
 
+	// 在释放锁之前恢复，其他协程不会读取到解析失败的配置
 	defer func() {
-		if err != nil {
-			*c = ConfigStruct{
-				configReady:    bak.configReady,
-				yamlHasParser:  bak.yamlHasParser,
-				sigchan:        bak.sigchan,
-				configPath:     bak.configPath,
-				configDir:      bak.configDir,
-				configFileName: bak.configFileName,
-				Yaml:           bak.Yaml,
-				// 新建类型 Lock不需要复制
-			}
+		if err != nil && err.IsError() { // 警告不影响重载
+			c.configReady = bak.configReady
+			c.yamlHasParser = bak.yamlHasParser
+			c.sigchan = bak.sigchan
+			c.configPath = bak.configPath
+			c.configDir = bak.configDir
+			c.configFileName = bak.configFileName
+			c.Yaml = bak.Yaml
 		}
 	}()
 
-	c.ConfigLock.Lock()
-	defer c.ConfigLock.Unlock()
-
 	reloadErr := c.reload()
 	if reloadErr != nil {
 		return NewConfigError("reload error: " + reloadErr.Error())
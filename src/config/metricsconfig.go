@@ -0,0 +1,37 @@
+package config
+
+import (
+	"fmt"
+	"net"
+	"strings"
+)
+
+type MetricsConfig struct {
+	Address string `yaml:"address"` // 监控指标（Prometheus 文本格式）的 HTTP 监听地址，例如 127.0.0.1:9273，为空表示不启用
+	Path    string `yaml:"path"`    // 监控指标的路径
+}
+
+func (m *MetricsConfig) setDefault() {
+	if m.Path == "" {
+		m.Path = "/metrics"
+	}
+
+	return
+}
+
+func (m *MetricsConfig) check() (err ConfigError) {
+	if m.Address == "" {
+		return nil
+	}
+
+	_, _, splitErr := net.SplitHostPort(m.Address)
+	if splitErr != nil {
+		return NewConfigError(fmt.Sprintf("bad metrics address: %s", splitErr.Error()))
+	}
+
+	if !strings.HasPrefix(m.Path, "/") {
+		return NewConfigError("metrics path must start with /")
+	}
+
+	return nil
+}
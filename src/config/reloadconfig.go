@@ -0,0 +1,32 @@
+package config
+
+import (
+	"github.com/SongZihuan/ssh-watcher/src/utils"
+	"time"
+)
+
+type AutoReloadConfig struct {
+	Watch utils.StringBool `yaml:"watch"` // 监听配置文件，文件变化时自动重载（等同于收到 SIGHUP）
+	Delay string           `yaml:"delay"` // 文件变化后等待的时长，期间的多次变化只重载一次
+
+	DelayDuration time.Duration `yaml:"-"`
+}
+
+func (r *AutoReloadConfig) setDefault() {
+	r.Watch.SetDefaultDisable()
+
+	if r.Delay == "" {
+		r.Delay = "1s"
+	}
+
+	return
+}
+
+func (r *AutoReloadConfig) check() (err ConfigError) {
+	r.DelayDuration = utils.ReadTimeDuration(r.Delay)
+	if r.DelayDuration <= 0 {
+		return NewConfigError("bad reload delay")
+	}
+
+	return nil
+}
@@ -53,13 +53,13 @@ func (r *RuleConfig) check() (err ConfigError) {
 		}
 	}
 
-	if r.IPv4 == "" && r.IPv6 == "" && r.IPv4Cidr == "" && r.IPv6Cidr == "" {
-		return NewConfigError("bad IP or CIDR")
-	}
-
 	return nil
 }
 
+func (r *RuleConfig) HasIP() bool {
+	return r.IPv4 != "" || r.IPv6 != "" || r.IPv4Cidr != "" || r.IPv6Cidr != ""
+}
+
 func (r *RuleConfig) HasLocation() bool {
 	return r.Nation != "" || r.NationVague != "" ||
 		r.Province != "" || r.ProvinceVague != "" ||
@@ -98,3 +98,23 @@ func (r *RuleConfig) CheckIP(ip net.IP) (bool, error) {
 
 	return false, nil
 }
+
+// Conditions 规则中设定的匹配条件，格式为 key=value
+func (r *RuleConfig) Conditions() []string {
+	res := make([]string, 0, 4)
+
+	for _, c := range []struct{ key, value string }{
+		{"nation", r.Nation}, {"nation-vague", r.NationVague},
+		{"province", r.Province}, {"province-vague", r.ProvinceVague},
+		{"city", r.City}, {"city-vague", r.CityVague},
+		{"isp", r.ISP}, {"isp-vague", r.ISPVague},
+		{"ipv4", r.IPv4}, {"ipv6", r.IPv6},
+		{"ipv4cidr", r.IPv4Cidr}, {"ipv6cidr", r.IPv6Cidr},
+	} {
+		if c.value != "" {
+			res = append(res, c.key+"="+c.value)
+		}
+	}
+
+	return res
+}
@@ -14,6 +14,11 @@ func initSignal(sigChan chan os.Signal) (err error) {
 		}
 	}()
 
-	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
+	signals := []os.Signal{syscall.SIGINT, syscall.SIGTERM, syscall.SIGHUP} // SIGHUP 表示重载配置
+	if SignalUpgrade != nil {
+		signals = append(signals, SignalUpgrade)
+	}
+
+	signal.Notify(sigChan, signals...)
 	return nil
 }
@@ -0,0 +1,10 @@
+//go:build !unix
+
+package config
+
+import (
+	"os"
+)
+
+// SignalUpgrade 当前平台不支持升级
+var SignalUpgrade os.Signal = nil
@@ -0,0 +1,11 @@
+//go:build unix
+
+package config
+
+import (
+	"os"
+	"syscall"
+)
+
+// SignalUpgrade 升级信号：启动新的可执行文件并交接监听
+var SignalUpgrade os.Signal = syscall.SIGUSR2
@@ -0,0 +1,45 @@
+package config
+
+import (
+	"github.com/SongZihuan/ssh-watcher/src/utils"
+	"time"
+)
+
+type SshAcceptConfig struct {
+	Workers         int64  `yaml:"workers"`          // 同时检查新连接（读取头部、IP定位、规则检查、连接回源地址）的数量
+	Queue           int64  `yaml:"queue"`            // 等待检查的连接数上限，超出时直接拒绝新连接
+	DecisionTimeout string `yaml:"decision-timeout"` // 从接受连接到决定放行或拒绝的最长时长（包括排队时间），forever 表示不限制
+
+	DecisionTimeoutDuration time.Duration `yaml:"-"` // 小于 0 表示不限制
+}
+
+func (s *SshAcceptConfig) setDefault() {
+	if s.Workers == 0 {
+		s.Workers = 16
+	}
+
+	if s.Queue == 0 {
+		s.Queue = 256
+	}
+
+	if s.DecisionTimeout == "" {
+		s.DecisionTimeout = "30s"
+	}
+
+	return
+}
+
+func (s *SshAcceptConfig) check() (err ConfigError) {
+	if s.Workers < 0 {
+		return NewConfigError("accept workers must be greater than 0")
+	} else if s.Queue < 0 {
+		return NewConfigError("accept queue must be greater than 0")
+	}
+
+	s.DecisionTimeoutDuration = utils.ReadTimeDuration(s.DecisionTimeout)
+	if s.DecisionTimeoutDuration == 0 {
+		return NewConfigError("bad accept decision-timeout")
+	}
+
+	return nil
+}
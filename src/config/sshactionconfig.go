@@ -0,0 +1,15 @@
+package config
+
+const (
+	ActionReject   = "reject"   // 立即断开连接
+	ActionTarpit   = "tarpit"   // 保持连接，缓慢发送无意义的前置行（仿 endlessh）
+	ActionHoneypot = "honeypot" // 交给内置的SSH蜜罐，记录尝试的用户名、密码和公钥，认证总是失败
+)
+
+func checkAction(action string) ConfigError {
+	if action != ActionReject && action != ActionTarpit && action != ActionHoneypot {
+		return NewConfigError("bad action: " + action)
+	}
+
+	return nil
+}
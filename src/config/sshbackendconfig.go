@@ -0,0 +1,143 @@
+package config
+
+import (
+	"fmt"
+	"github.com/SongZihuan/ssh-watcher/src/utils"
+	"net"
+	"strings"
+	"time"
+)
+
+const (
+	BackendStrategyPrimaryBackup = "primary-backup"
+	BackendStrategyRoundRobin    = "round-robin"
+	BackendStrategyLeastConn     = "least-conn"
+	BackendStrategySourceHash    = "source-hash"
+)
+
+// UnixAddressPrefix 回源地址使用该前缀时表示 Unix 套接字，例如 unix:/run/sshd.sock
+const UnixAddressPrefix = "unix:"
+
+const (
+	HealthCheckNone      = "none"
+	HealthCheckTCP       = "tcp"
+	HealthCheckSSHBanner = "ssh-banner"
+)
+
+type SshBackendConfig struct {
+	Address string           `yaml:"address"` // TCP 地址，或者 unix: 开头的 Unix 套接字路径
+	Backup  utils.StringBool `yaml:"backup"`  // 备用节点，仅在 primary-backup 策略下生效
+
+	ResolveAddress     *net.TCPAddr  `yaml:"-"`
+	ResolveUnixAddress *net.UnixAddr `yaml:"-"`
+	Network            string        `yaml:"-"` // tcp4、tcp6 或 unix
+}
+
+func (s *SshBackendConfig) setDefault() {
+	s.Backup.SetDefaultDisable()
+	return
+}
+
+func (s *SshBackendConfig) check() (err ConfigError) {
+	if s.Address == "" {
+		return NewConfigError("backend address is empty")
+	}
+
+	if strings.HasPrefix(s.Address, UnixAddressPrefix) {
+		unixAddr, err := resolveUnixAddress(s.Address)
+		if err != nil && err.IsError() {
+			return err
+		}
+
+		s.ResolveUnixAddress = unixAddr
+		s.Network = "unix"
+		return nil
+	}
+
+	addr, rErr := net.ResolveTCPAddr("tcp", s.Address)
+	if rErr != nil {
+		return NewConfigError(fmt.Sprintf("backend address %s not valid: %s", s.Address, rErr.Error()))
+	}
+
+	s.ResolveAddress = addr
+	if addr.IP != nil && addr.IP.To4() == nil {
+		s.Network = "tcp6"
+	} else {
+		s.Network = "tcp4"
+	}
+
+	return nil
+}
+
+type SshHealthCheckConfig struct {
+	Type     string `yaml:"type"`     // none, tcp, ssh-banner
+	Interval string `yaml:"interval"` // 检查间隔
+	Timeout  string `yaml:"timeout"`  // 单次检查超时
+	Rise     int64  `yaml:"rise"`     // 连续成功多少次后标记为可用
+	Fall     int64  `yaml:"fall"`     // 连续失败多少次后标记为不可用
+
+	IntervalDuration time.Duration `yaml:"-"`
+	TimeoutDuration  time.Duration `yaml:"-"`
+}
+
+func resolveUnixAddress(address string) (*net.UnixAddr, ConfigError) {
+	path := strings.TrimPrefix(address, UnixAddressPrefix)
+	if path == "" {
+		return nil, NewConfigError(fmt.Sprintf("unix address %s is empty", address))
+	}
+
+	addr, err := net.ResolveUnixAddr("unix", path)
+	if err != nil {
+		return nil, NewConfigError(fmt.Sprintf("unix address %s not valid: %s", address, err.Error()))
+	}
+
+	return addr, nil
+}
+
+func (s *SshHealthCheckConfig) setDefault() {
+	if s.Type == "" {
+		s.Type = HealthCheckSSHBanner
+	}
+
+	if s.Interval == "" {
+		s.Interval = "10s"
+	}
+
+	if s.Timeout == "" {
+		s.Timeout = "3s"
+	}
+
+	if s.Rise <= 0 {
+		s.Rise = 2
+	}
+
+	if s.Fall <= 0 {
+		s.Fall = 3
+	}
+
+	return
+}
+
+func (s *SshHealthCheckConfig) check() (err ConfigError) {
+	if s.Type != HealthCheckNone && s.Type != HealthCheckTCP && s.Type != HealthCheckSSHBanner {
+		return NewConfigError(fmt.Sprintf("bad health check type: %s", s.Type))
+	}
+
+	s.IntervalDuration = utils.ReadTimeDuration(s.Interval)
+	if s.IntervalDuration < time.Second {
+		return NewConfigError("bad health check interval, must more than 1 second")
+	}
+
+	s.TimeoutDuration = utils.ReadTimeDuration(s.Timeout)
+	if s.TimeoutDuration <= 0 {
+		return NewConfigError("bad health check timeout")
+	} else if s.TimeoutDuration >= s.IntervalDuration {
+		return NewConfigError("health check timeout must less than interval")
+	}
+
+	return nil
+}
+
+func (s *SshHealthCheckConfig) IsEnable() bool {
+	return s.Type != HealthCheckNone
+}
@@ -0,0 +1,62 @@
+package config
+
+import "github.com/SongZihuan/ssh-watcher/src/utils"
+
+type SshBandwidthConfig struct {
+	Upload   string `yaml:"upload"`   // 客户端 -> 回源地址 每秒字节数，例如 1MB，为空表示不限制
+	Download string `yaml:"download"` // 回源地址 -> 客户端 每秒字节数，为空表示不限制
+
+	UploadLimit   int64 `yaml:"-"`
+	DownloadLimit int64 `yaml:"-"`
+}
+
+func (s *SshBandwidthConfig) setDefault() {
+	return
+}
+
+func (s *SshBandwidthConfig) check() (err ConfigError) {
+	if s.Upload != "" {
+		s.UploadLimit = int64(utils.ReadBytes(s.Upload))
+		if s.UploadLimit <= 0 {
+			return NewConfigError("bad bandwidth upload")
+		}
+	}
+
+	if s.Download != "" {
+		s.DownloadLimit = int64(utils.ReadBytes(s.Download))
+		if s.DownloadLimit <= 0 {
+			return NewConfigError("bad bandwidth download")
+		}
+	}
+
+	return nil
+}
+
+func (s *SshBandwidthConfig) IsEnable() bool {
+	return s.UploadLimit > 0 || s.DownloadLimit > 0
+}
+
+type SshForwardBandwidthConfig struct {
+	Session SshBandwidthConfig `yaml:"session"` // 每个会话单独的限速
+	IP      SshBandwidthConfig `yaml:"ip"`      // 同一来源IP的所有会话共享的限速
+}
+
+func (s *SshForwardBandwidthConfig) setDefault() {
+	s.Session.setDefault()
+	s.IP.setDefault()
+	return
+}
+
+func (s *SshForwardBandwidthConfig) check() (err ConfigError) {
+	err = s.Session.check()
+	if err != nil && err.IsError() {
+		return err
+	}
+
+	err = s.IP.check()
+	if err != nil && err.IsError() {
+		return err
+	}
+
+	return nil
+}
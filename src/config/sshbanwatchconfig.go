@@ -0,0 +1,49 @@
+package config
+
+import (
+	"fmt"
+	"github.com/SongZihuan/ssh-watcher/src/utils"
+	"time"
+)
+
+const (
+	BanWatchModeEnforce = "enforce"
+	BanWatchModeAlert   = "alert"
+	BanWatchModeOff     = "off"
+)
+
+type SshBanWatchConfig struct {
+	Mode     string `yaml:"mode"`     // enforce 断开来源被封禁的会话，alert 只推送消息，off 不检查
+	Interval string `yaml:"interval"` // 检查已建立的会话的间隔，重载配置后会立即检查一次
+
+	IntervalDuration time.Duration `yaml:"-"`
+}
+
+func (s *SshBanWatchConfig) setDefault() {
+	if s.Mode == "" {
+		s.Mode = BanWatchModeEnforce
+	}
+
+	if s.Interval == "" {
+		s.Interval = "30s"
+	}
+
+	return
+}
+
+func (s *SshBanWatchConfig) check() (err ConfigError) {
+	if s.Mode != BanWatchModeEnforce && s.Mode != BanWatchModeAlert && s.Mode != BanWatchModeOff {
+		return NewConfigError(fmt.Sprintf("bad ban-watch mode: %s", s.Mode))
+	}
+
+	s.IntervalDuration = utils.ReadTimeDuration(s.Interval)
+	if s.IntervalDuration < time.Second {
+		return NewConfigError("bad ban-watch interval, must more than 1 second")
+	}
+
+	return nil
+}
+
+func (s *SshBanWatchConfig) IsEnable() bool {
+	return s.Mode != BanWatchModeOff
+}
@@ -1,13 +1,45 @@
 package config
 
+import (
+	"fmt"
+	"strings"
+)
+
 type SshConfig struct {
-	RuleList SshRuleListConfig `yaml:",inline"`
-	Forward  SshForwardConfig  `yaml:",inline"`
+	RuleList SshRuleListConfig   `yaml:",inline"`
+	Forward  SshForwardConfig    `yaml:",inline"`
+	Forwards []*SshForwardConfig `yaml:"forwards"` // 多个独立转发，设置后忽略上面的 Forward
+	Tarpit   SshTarpitConfig     `yaml:"tarpit"`   // 拖延（tarpit）动作的全局设定
+	Honeypot SshHoneypotConfig   `yaml:"honeypot"` // 蜜罐（honeypot）动作的全局设定
+
+	ForwardList []*SshForwardConfig `yaml:"-"`
 }
 
 func (s *SshConfig) setDefault() {
 	s.RuleList.setDefault()
-	s.Forward.setDefault()
+	s.Tarpit.setDefault()
+	s.Honeypot.setDefault()
+
+	if len(s.Forwards) == 0 {
+		if s.Forward.Name == "" {
+			s.Forward.Name = "default"
+		}
+
+		s.Forward.setDefault()
+	} else {
+		for i, f := range s.Forwards {
+			if f == nil { // 空的转发（例如 YAML 中多余的 -）由 check 报告错误
+				continue
+			}
+
+			if f.Name == "" {
+				f.Name = fmt.Sprintf("forward-%d", i+1)
+			}
+
+			f.setDefault()
+		}
+	}
+
 	return
 }
 
@@ -17,10 +49,48 @@ func (s *SshConfig) check() (err ConfigError) {
 		return err
 	}
 
-	err = s.Forward.check()
+	err = s.Tarpit.check()
+	if err != nil && err.IsError() {
+		return err
+	}
+
+	err = s.Honeypot.check()
 	if err != nil && err.IsError() {
 		return err
 	}
 
+	if len(s.Forwards) == 0 {
+		s.ForwardList = []*SshForwardConfig{&s.Forward}
+	} else {
+		s.ForwardList = s.Forwards
+	}
+
+	names := make(map[string]bool, len(s.ForwardList))
+	for _, f := range s.ForwardList {
+		if f == nil {
+			return NewConfigError("forward is empty")
+		}
+
+		if strings.Contains(f.Name, ":") { // 升级时各转发的监听名称以冒号分隔传给新进程
+			return NewConfigError(fmt.Sprintf("forward name %s contains ':'", f.Name))
+		}
+
+		if names[f.Name] {
+			return NewConfigError(fmt.Sprintf("forward name %s is duplicate", f.Name))
+		}
+		names[f.Name] = true
+
+		err = f.check()
+		if err != nil && err.IsError() {
+			return err
+		}
+
+		if f.RuleList != nil {
+			f.ResolveRuleList = f.RuleList
+		} else {
+			f.ResolveRuleList = &s.RuleList
+		}
+	}
+
 	return
 }
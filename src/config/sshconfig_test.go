@@ -0,0 +1,20 @@
+package config
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSshConfigForwardNameColon(t *testing.T) {
+	cfg := SshConfig{
+		Forwards: []*SshForwardConfig{{Name: "a:b", SrcPort: 2222, DestAddress: "127.0.0.1:22"}},
+	}
+	cfg.setDefault()
+
+	err := cfg.check()
+	if err == nil || !err.IsError() {
+		t.Fatalf("forward name with ':' should be rejected")
+	} else if !strings.Contains(err.Error(), "contains ':'") {
+		t.Fatalf("unexpected error: %s", err.Error())
+	}
+}
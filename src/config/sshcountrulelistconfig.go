@@ -1,12 +1,32 @@
 package config
 
+import "github.com/SongZihuan/ssh-watcher/src/utils"
+
+const (
+	CountRuleKeyIP    = "ip"    // 按来源IP计数，命中后封禁IP
+	CountRuleKeyHASSH = "hassh" // 按客户端 HASSH 指纹计数（不区分IP），命中后封禁指纹
+)
+
 type SshCountRuleConfig struct {
-	TryCount      int64 `yaml:"try-count"`      // 尝试次数
-	Seconds       int64 `yaml:"seconds"`        // 记录保持时间
-	BannedSeconds int64 `yaml:"banned-seconds"` // 封禁时长
+	Key           string `yaml:"key"`            // 计数的依据：ip 或 hassh
+	Action        string `yaml:"action"`         // 封禁期间对连接的处理方式：reject、tarpit 或 honeypot（仅 key 为 ip 时有效）
+	TryCount      int64  `yaml:"try-count"`      // 尝试次数
+	Seconds       int64  `yaml:"seconds"`        // 记录保持时间
+	BannedSeconds int64  `yaml:"banned-seconds"` // 封禁时长
+	TransferBytes string `yaml:"transfer-bytes"` // 记录保持时间内传输的字节数（上传+下载）超过该值也视为命中，为空表示不启用
+
+	TransferBytesLimit int64 `yaml:"-"`
 }
 
 func (s *SshCountRuleConfig) setDefault() {
+	if s.Key == "" {
+		s.Key = CountRuleKeyIP
+	}
+
+	if s.Action == "" {
+		s.Action = ActionReject
+	}
+
 	return
 }
 
@@ -22,5 +42,30 @@ func (s *SshCountRuleConfig) check() (err ConfigError) {
 	if s.BannedSeconds <= 0 {
 		return NewConfigError("banned-seconds must be greater than 0")
 	}
+
+	if s.Key != CountRuleKeyIP && s.Key != CountRuleKeyHASSH {
+		return NewConfigError("bad count rule key")
+	}
+
+	err = checkAction(s.Action)
+	if err != nil && err.IsError() {
+		return err
+	}
+
+	if s.Key != CountRuleKeyIP && s.Action != ActionReject {
+		_ = NewConfigWarning("action only support count rule with key ip, it will be ignored")
+	}
+
+	if s.TransferBytes != "" {
+		s.TransferBytesLimit = int64(utils.ReadBytes(s.TransferBytes))
+		if s.TransferBytesLimit <= 0 {
+			return NewConfigError("bad transfer-bytes")
+		}
+
+		if s.Key != CountRuleKeyIP {
+			_ = NewConfigWarning("transfer-bytes only support count rule with key ip, it will be ignored")
+		}
+	}
+
 	return nil
 }
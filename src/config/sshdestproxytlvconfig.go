@@ -0,0 +1,29 @@
+package config
+
+import (
+	"github.com/SongZihuan/ssh-watcher/src/utils"
+)
+
+// SshDestProxyTLVConfig 发送给回源地址的 Proxy 协议头部中附加的 TLV，仅在 Proxy 协议版本 2 时生效
+type SshDestProxyTLVConfig struct {
+	Context     utils.StringBool `yaml:"context"`     // 附加本次连接的判定信息：连接记录的 ID、唯一 ID、IP定位和命中的规则
+	Passthrough utils.StringBool `yaml:"passthrough"` // 透传来访连接的 Proxy 协议头部中的 TLV
+}
+
+func (s *SshDestProxyTLVConfig) setDefault() {
+	s.Context.SetDefaultDisable()
+	s.Passthrough.SetDefaultDisable()
+	return
+}
+
+func (s *SshDestProxyTLVConfig) check(ipv4Version int, ipv6Version int) (err ConfigError) {
+	if !s.Context.IsEnable(false) && !s.Passthrough.IsEnable(false) {
+		return nil
+	}
+
+	if ipv4Version == 1 && ipv6Version == 1 {
+		_ = NewConfigWarning("dest-proxy-tlv only works with proxy protocol version 2")
+	}
+
+	return nil
+}
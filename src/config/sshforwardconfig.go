@@ -5,20 +5,52 @@ import (
 	"github.com/SongZihuan/ssh-watcher/src/ipcheck"
 	"github.com/SongZihuan/ssh-watcher/src/utils"
 	"net"
+	"strconv"
+	"strings"
+	"time"
 )
 
+const maxListenAddresses = 1024 // 单个转发最多监听的地址数（地址数 × 端口数）
+
 type SshForwardConfig struct {
+	Name            string           `yaml:"name"`
 	SrcPort         int64            `yaml:"src"`
-	DestAddress     string           `yaml:"dest"`
+	Ports           []string         `yaml:"ports"` // 多个监听端口或端口范围（例如 2222、3000-3010），设置后忽略 src
+	Bind            []string         `yaml:"bind"`  // 监听的地址或网卡名称（例如 203.0.113.5、wg0），为空表示监听全部地址
+	DestAddress     string           `yaml:"dest"`  // TCP 地址，或者 unix: 开头的 Unix 套接字路径
 	IPv4DestAddress string           `yaml:"ipv4-dest"`
 	IPv6DestAddress string           `yaml:"ipv6-dest"`
 	AllowCross      utils.StringBool `yaml:"allow-cross"` // 允许 ipv4 -> ipv6 或 ipv6 -> ipv4
 
+	Backends    []*SshBackendConfig  `yaml:"backends"` // 回源地址池，设置后忽略 dest、ipv4-dest 和 ipv6-dest
+	Strategy    string               `yaml:"strategy"` // primary-backup, round-robin, least-conn, source-hash
+	HealthCheck SshHealthCheckConfig `yaml:"health-check"`
+	DialTimeout string               `yaml:"dial-timeout"`
+	Hold        SshHoldConfig        `yaml:"hold"` // 回源地址暂时不可用时保持已通过检查的客户端连接并重试
+
+	Accept SshAcceptConfig `yaml:"accept"` // 新连接的检查（工作协程数、排队上限和判定超时）
+
+	Session SshSessionConfig `yaml:"session"` // 会话超时和 TCP keepalive 设定
+	Limit   SshLimitConfig   `yaml:"limit"`   // 并发会话数限制，0 表示不限制
+
+	RateLimit SshRateLimitConfig `yaml:"rate-limit"` // 新连接速率限制，在IP定位和数据库查询之前丢弃超出的连接
+
+	BanWatch SshBanWatchConfig `yaml:"ban-watch"` // 会话建立后来源被封禁时的处理
+
+	Bandwidth SshForwardBandwidthConfig `yaml:"bandwidth"` // 限速设定
+
+	DrainTimeout string `yaml:"drain-timeout"` // 停止时等待会话结束的最长时长，超时后强制断开
+
+	Maintenance SshMaintenanceConfig `yaml:"maintenance"` // 维护模式
+
+	Mux SshMuxConfig `yaml:"mux"` // 按协议分流：读取开头的数据，SSH 转发到回源地址，TLS、HTTP 等转发到各自的地址
+
 	HeaderCheck utils.StringBool `yaml:"header-check"`
 	Header      string           `yaml:"header"`
 
-	IPv4SrcServerProxy utils.StringBool `yaml:"ipv4-src-proxy"`
-	IPv6SrcServerProxy utils.StringBool `yaml:"ipv6-src-proxy"`
+	IPv4SrcServerProxy utils.StringBool  `yaml:"ipv4-src-proxy"`
+	IPv6SrcServerProxy utils.StringBool  `yaml:"ipv6-src-proxy"`
+	SrcProxy           SshSrcProxyConfig `yaml:"src-proxy"` // 允许发送 Proxy 协议头部的上游
 
 	IPv4DestRequestProxy        utils.StringBool `yaml:"ipv4-dest-proxy"`
 	IPv4DestRequestProxyVersion int              `yaml:"ipv4-dest-proxy-version"`
@@ -26,20 +58,27 @@ type SshForwardConfig struct {
 	IPv6DestRequestProxy        utils.StringBool `yaml:"ipv6-dest-proxy"`
 	IPv6DestRequestProxyVersion int              `yaml:"ipv6-dest-proxy-version"`
 
+	DestProxyTLV SshDestProxyTLVConfig `yaml:"dest-proxy-tlv"` // 发送给回源地址的 Proxy 协议头部中附加的 TLV
+
 	CountRules []*SshCountRuleConfig `yaml:"count-rules"` // 全局连接规则
+	RuleList   *SshRuleListConfig    `yaml:"rule-list"`   // 转发独立的规则列表，为空时使用全局规则列表
+
+	ResolveListenAddresses []*net.TCPAddr `yaml:"-"` // 实际监听的地址，0.0.0.0 和 :: 表示全部地址
 
-	ResolveIPv4SrcAddress  *net.TCPAddr `yaml:"-"`
-	ResolveIPv4DestAddress *net.TCPAddr `yaml:"-"`
+	ResolveIPv4DestAddress *net.TCPAddr  `yaml:"-"`
+	ResolveIPv6DestAddress *net.TCPAddr  `yaml:"-"`
+	ResolveUnixDestAddress *net.UnixAddr `yaml:"-"`
 
-	ResolveIPv6SrcAddress  *net.TCPAddr `yaml:"-"`
-	ResolveIPv6DestAddress *net.TCPAddr `yaml:"-"`
+	Cross               bool               `yaml:"-"` // 开启交叉
+	HeaderBytes         []byte             `yaml:"-"`
+	ResolveRuleList     *SshRuleListConfig `yaml:"-"` // 实际生效的规则列表
+	DialTimeoutDuration time.Duration      `yaml:"-"`
 
-	Cross       bool   `yaml:"-"` // 开启交叉
-	HeaderBytes []byte `yaml:"-"`
+	DrainTimeoutDuration time.Duration `yaml:"-"`
 }
 
 func (s *SshForwardConfig) setDefault() {
-	if s.SrcPort == 0 {
+	if s.SrcPort == 0 && len(s.Ports) == 0 {
 		s.SrcPort = 22
 	}
 
@@ -47,6 +86,7 @@ func (s *SshForwardConfig) setDefault() {
 
 	s.IPv4SrcServerProxy.SetDefaultDisable()
 	s.IPv6SrcServerProxy.SetDefaultDisable()
+	s.SrcProxy.setDefault()
 
 	s.IPv4DestRequestProxy.SetDefaultDisable()
 	s.IPv6DestRequestProxy.SetDefaultDisable()
@@ -59,8 +99,38 @@ func (s *SshForwardConfig) setDefault() {
 		s.IPv6DestRequestProxyVersion = 1
 	}
 
+	s.DestProxyTLV.setDefault()
+
 	s.HeaderCheck.SetDefaultEnable()
 
+	for _, b := range s.Backends {
+		b.setDefault()
+	}
+
+	if s.Strategy == "" {
+		s.Strategy = BackendStrategyPrimaryBackup
+	}
+
+	s.HealthCheck.setDefault()
+
+	if s.DialTimeout == "" {
+		s.DialTimeout = "10s"
+	}
+
+	if s.DrainTimeout == "" {
+		s.DrainTimeout = "10s"
+	}
+
+	s.Hold.setDefault()
+	s.Accept.setDefault()
+	s.Session.setDefault()
+	s.Limit.setDefault()
+	s.RateLimit.setDefault()
+	s.BanWatch.setDefault()
+	s.Maintenance.setDefault()
+	s.Mux.setDefault()
+	s.Bandwidth.setDefault()
+
 	if s.HeaderCheck.IsEnable(true) && s.Header == "" {
 		s.Header = "SSH-2.0-"
 	}
@@ -69,14 +139,52 @@ func (s *SshForwardConfig) setDefault() {
 		r.setDefault()
 	}
 
+	if s.RuleList != nil {
+		s.RuleList.setDefault()
+	}
+
 	return
 }
 
 func (s *SshForwardConfig) check() (cfgErr ConfigError) {
-	if s.SrcPort <= 0 || s.SrcPort > 65535 { // 一般不建议使用端口号0
-		return NewConfigError("src point must be between 1 and 65535")
+	if s.Name == "" {
+		return NewConfigError("forward name is empty")
+	} else if len(s.Name) > 50 {
+		return NewConfigError(fmt.Sprintf("forward name %s is too long", s.Name))
+	} else if strings.HasPrefix(s.Name, "@") { // 保留给监控指标等非转发的监听，见升级时传递的监听
+		return NewConfigError(fmt.Sprintf("forward name %s must not start with @", s.Name))
+	}
+
+	ports, cfgErr := s.listenPorts()
+	if cfgErr != nil && cfgErr.IsError() {
+		return cfgErr
+	}
+
+	ips, cfgErr := s.bindIPs()
+	if cfgErr != nil && cfgErr.IsError() {
+		return cfgErr
+	}
+
+	s.ResolveListenAddresses = make([]*net.TCPAddr, 0, len(ips)*len(ports))
+	listenSeen := make(map[string]bool, len(ips)*len(ports))
+	for _, ip := range ips {
+		for _, port := range ports {
+			addr := &net.TCPAddr{IP: ip.IP, Port: port, Zone: ip.Zone}
+			if listenSeen[addr.String()] { // 地址和网卡可能重复
+				continue
+			}
+
+			listenSeen[addr.String()] = true
+			s.ResolveListenAddresses = append(s.ResolveListenAddresses, addr)
+		}
+	}
+
+	if len(s.ResolveListenAddresses) > maxListenAddresses {
+		return NewConfigError(fmt.Sprintf("too many listen addresses (%d), must not more than %d", len(s.ResolveListenAddresses), maxListenAddresses))
 	}
 
+	unixDest := len(s.Backends) == 0 && strings.HasPrefix(s.DestAddress, UnixAddressPrefix)
+
 	if s.HeaderCheck.IsEnable(true) {
 		s.HeaderBytes = []byte(s.Header)
 	} else {
@@ -87,7 +195,104 @@ func (s *SshForwardConfig) check() (cfgErr ConfigError) {
 		_ = NewConfigWarning("ssh does not recommend using proxy protocol")
 	}
 
-	if ipcheck.SupportIPv4() {
+	s.DialTimeoutDuration = utils.ReadTimeDuration(s.DialTimeout)
+	if s.DialTimeoutDuration <= 0 {
+		return NewConfigError("bad dial-timeout")
+	}
+
+	s.DrainTimeoutDuration = utils.ReadTimeDuration(s.DrainTimeout)
+	if s.DrainTimeoutDuration < 0 {
+		return NewConfigError("bad drain-timeout") // 不允许无限等待
+	}
+
+	cfgErr = s.DestProxyTLV.check(s.IPv4DestRequestProxyVersion, s.IPv6DestRequestProxyVersion)
+	if cfgErr != nil && cfgErr.IsError() {
+		return cfgErr
+	}
+
+	cfgErr = s.SrcProxy.check(s.IPv4SrcServerProxy.IsEnable(false) || s.IPv6SrcServerProxy.IsEnable(false))
+	if cfgErr != nil && cfgErr.IsError() {
+		return cfgErr
+	}
+
+	cfgErr = s.Hold.check()
+	if cfgErr != nil && cfgErr.IsError() {
+		return cfgErr
+	}
+
+	cfgErr = s.Accept.check()
+	if cfgErr != nil && cfgErr.IsError() {
+		return cfgErr
+	}
+
+	cfgErr = s.Session.check()
+	if cfgErr != nil && cfgErr.IsError() {
+		return cfgErr
+	}
+
+	cfgErr = s.Limit.check()
+	if cfgErr != nil && cfgErr.IsError() {
+		return cfgErr
+	}
+
+	cfgErr = s.RateLimit.check()
+	if cfgErr != nil && cfgErr.IsError() {
+		return cfgErr
+	}
+
+	cfgErr = s.BanWatch.check()
+	if cfgErr != nil && cfgErr.IsError() {
+		return cfgErr
+	}
+
+	cfgErr = s.Maintenance.check()
+	if cfgErr != nil && cfgErr.IsError() {
+		return cfgErr
+	}
+
+	cfgErr = s.Mux.check()
+	if cfgErr != nil && cfgErr.IsError() {
+		return cfgErr
+	}
+
+	cfgErr = s.Bandwidth.check()
+	if cfgErr != nil && cfgErr.IsError() {
+		return cfgErr
+	}
+
+	if unixDest {
+		unixAddr, err := resolveUnixAddress(s.DestAddress)
+		if err != nil && err.IsError() {
+			return err
+		}
+
+		s.ResolveUnixDestAddress = unixAddr
+
+		if s.IPv4DestAddress != "" || s.IPv6DestAddress != "" {
+			_ = NewConfigWarning(fmt.Sprintf("forward %s: dest is a unix address, ipv4-dest and ipv6-dest will be ignored", s.Name))
+		}
+	} else if len(s.Backends) > 0 {
+		if s.Strategy != BackendStrategyPrimaryBackup && s.Strategy != BackendStrategyRoundRobin &&
+			s.Strategy != BackendStrategyLeastConn && s.Strategy != BackendStrategySourceHash {
+			return NewConfigError(fmt.Sprintf("bad backend strategy: %s", s.Strategy))
+		}
+
+		for _, b := range s.Backends {
+			err := b.check()
+			if err != nil && err.IsError() {
+				return err
+			}
+		}
+
+		err := s.HealthCheck.check()
+		if err != nil && err.IsError() {
+			return err
+		}
+
+		if s.DestAddress != "" || s.IPv4DestAddress != "" || s.IPv6DestAddress != "" {
+			_ = NewConfigWarning(fmt.Sprintf("forward %s: backends is set, dest, ipv4-dest and ipv6-dest will be ignored", s.Name))
+		}
+	} else if ipcheck.SupportIPv4() {
 		if s.IPv4DestAddress != "" {
 			ip4, err := net.ResolveTCPAddr("tcp4", s.IPv4DestAddress)
 			if err != nil {
@@ -109,7 +314,7 @@ func (s *SshForwardConfig) check() (cfgErr ConfigError) {
 		}
 	}
 
-	if ipcheck.SupportIPv6() {
+	if len(s.Backends) == 0 && !unixDest && ipcheck.SupportIPv6() {
 		if s.IPv6DestAddress != "" {
 			ip6, err := net.ResolveTCPAddr("tcp6", s.IPv6DestAddress)
 			if err != nil {
@@ -131,27 +336,11 @@ func (s *SshForwardConfig) check() (cfgErr ConfigError) {
 		}
 	}
 
-	{
-		ip4, err := net.ResolveTCPAddr("tcp4", fmt.Sprintf(":%d", s.SrcPort))
-		if err != nil {
-			return NewConfigError(fmt.Sprintf("ipv4 src address not valid: %s", err.Error()))
-		}
-
-		s.ResolveIPv4SrcAddress = ip4
-
-		ip6, err := net.ResolveTCPAddr("tcp6", fmt.Sprintf(":%d", s.SrcPort))
-		if err != nil {
-			return NewConfigError(fmt.Sprintf("ipv6 src address not valid: %s", err.Error()))
-		}
-
-		s.ResolveIPv6SrcAddress = ip6
-	}
-
-	if s.ResolveIPv4DestAddress == nil && s.ResolveIPv6DestAddress == nil {
+	if len(s.Backends) == 0 && s.ResolveUnixDestAddress == nil && s.ResolveIPv4DestAddress == nil && s.ResolveIPv6DestAddress == nil {
 		return NewConfigError("dest address not valid")
 	}
 
-	s.Cross = s.AllowCross.IsEnable(true) && ipcheck.SupportIPv4() && ipcheck.SupportIPv6() && (s.ResolveIPv4DestAddress == nil || s.ResolveIPv6DestAddress == nil)
+	s.Cross = s.AllowCross.IsEnable(true) && s.ResolveUnixDestAddress == nil && ipcheck.SupportIPv4() && ipcheck.SupportIPv6() && (s.ResolveIPv4DestAddress == nil || s.ResolveIPv6DestAddress == nil)
 
 	tr := int64(-1)
 	ms := int64(-1)
@@ -171,5 +360,121 @@ func (s *SshForwardConfig) check() (cfgErr ConfigError) {
 		}
 	}
 
+	if s.RuleList != nil {
+		cfgErr = s.RuleList.check()
+		if cfgErr != nil && cfgErr.IsError() {
+			return cfgErr
+		}
+	}
+
 	return nil
 }
+
+// listenPorts 返回需要监听的端口，设置了 ports 时忽略 src
+func (s *SshForwardConfig) listenPorts() ([]int, ConfigError) {
+	if len(s.Ports) == 0 {
+		if s.SrcPort <= 0 || s.SrcPort > 65535 { // 一般不建议使用端口号0
+			return nil, NewConfigError("src point must be between 1 and 65535")
+		}
+
+		return []int{int(s.SrcPort)}, nil
+	}
+
+	if s.SrcPort != 0 {
+		_ = NewConfigWarning(fmt.Sprintf("forward %s: ports is set, src will be ignored", s.Name))
+	}
+
+	res := make([]int, 0, len(s.Ports))
+	seen := make(map[int]bool, len(s.Ports))
+	for _, p := range s.Ports {
+		start, end, err := parsePortRange(p)
+		if err != nil {
+			return nil, NewConfigError(fmt.Sprintf("bad port %s: %s", p, err.Error()))
+		}
+
+		for port := start; port <= end; port++ {
+			if seen[port] {
+				continue
+			}
+
+			seen[port] = true
+			res = append(res, port)
+
+			if len(res) > maxListenAddresses {
+				return nil, NewConfigError(fmt.Sprintf("too many ports, must not more than %d", maxListenAddresses))
+			}
+		}
+	}
+
+	return res, nil
+}
+
+// bindIPs 返回需要监听的地址，bind 中的网卡名称会被解析为该网卡当前的全部地址
+func (s *SshForwardConfig) bindIPs() ([]*net.IPAddr, ConfigError) {
+	if len(s.Bind) == 0 {
+		return []*net.IPAddr{{IP: net.IPv4zero}, {IP: net.IPv6unspecified}}, nil
+	}
+
+	res := make([]*net.IPAddr, 0, len(s.Bind))
+	for _, b := range s.Bind {
+		if ip := net.ParseIP(b); ip != nil {
+			res = append(res, &net.IPAddr{IP: ip})
+			continue
+		}
+
+		iface, err := net.InterfaceByName(b)
+		if err != nil {
+			return nil, NewConfigError(fmt.Sprintf("bind %s is neither an ip address nor an interface: %s", b, err.Error()))
+		}
+
+		addrs, err := iface.Addrs()
+		if err != nil {
+			return nil, NewConfigError(fmt.Sprintf("get addresses of interface %s failed: %s", b, err.Error()))
+		}
+
+		count := 0
+		for _, addr := range addrs {
+			ipNet, ok := addr.(*net.IPNet)
+			if !ok {
+				continue
+			}
+
+			zone := ""
+			if ipNet.IP.To4() == nil && ipNet.IP.IsLinkLocalUnicast() {
+				zone = iface.Name // IPv6 链路本地地址需要指定网卡
+			}
+
+			res = append(res, &net.IPAddr{IP: ipNet.IP, Zone: zone})
+			count++
+		}
+
+		if count == 0 {
+			return nil, NewConfigError(fmt.Sprintf("interface %s has no address", b))
+		}
+	}
+
+	return res, nil
+}
+
+func parsePortRange(str string) (start int, end int, err error) {
+	startStr, endStr, isRange := strings.Cut(strings.TrimSpace(str), "-")
+
+	start, err = strconv.Atoi(strings.TrimSpace(startStr))
+	if err != nil {
+		return 0, 0, err
+	}
+
+	end = start
+	if isRange {
+		end, err = strconv.Atoi(strings.TrimSpace(endStr))
+		if err != nil {
+			return 0, 0, err
+		}
+	}
+
+	if start <= 0 || end > 65535 || start > end {
+		return 0, 0, fmt.Errorf("port must be between 1 and 65535")
+	}
+
+	return start, end, nil
+}
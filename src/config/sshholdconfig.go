@@ -0,0 +1,51 @@
+package config
+
+import (
+	"github.com/SongZihuan/ssh-watcher/src/utils"
+	"time"
+)
+
+type SshHoldConfig struct {
+	Window     string `yaml:"window"`      // 连接回源地址失败时保持客户端连接并重试的最长时长，为空或0表示不重试
+	Backoff    string `yaml:"backoff"`     // 第一次重试前的等待时长，此后每次翻倍
+	MaxBackoff string `yaml:"max-backoff"` // 两次重试之间最长的等待时长
+
+	WindowDuration     time.Duration `yaml:"-"`
+	BackoffDuration    time.Duration `yaml:"-"`
+	MaxBackoffDuration time.Duration `yaml:"-"`
+}
+
+func (s *SshHoldConfig) setDefault() {
+	if s.Backoff == "" {
+		s.Backoff = "1s"
+	}
+
+	if s.MaxBackoff == "" {
+		s.MaxBackoff = "8s"
+	}
+
+	return
+}
+
+func (s *SshHoldConfig) check() (err ConfigError) {
+	s.WindowDuration = utils.ReadTimeDuration(s.Window)
+	if s.WindowDuration < 0 {
+		return NewConfigError("bad hold window")
+	}
+
+	s.BackoffDuration = utils.ReadTimeDuration(s.Backoff)
+	if s.BackoffDuration <= 0 {
+		return NewConfigError("bad hold backoff")
+	}
+
+	s.MaxBackoffDuration = utils.ReadTimeDuration(s.MaxBackoff)
+	if s.MaxBackoffDuration < s.BackoffDuration {
+		return NewConfigError("bad hold max-backoff, must not be less than backoff")
+	}
+
+	return nil
+}
+
+func (s *SshHoldConfig) IsEnable() bool {
+	return s.WindowDuration > 0
+}
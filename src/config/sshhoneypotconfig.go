@@ -0,0 +1,79 @@
+package config
+
+import (
+	"github.com/SongZihuan/ssh-watcher/src/utils"
+	"strings"
+	"time"
+)
+
+type SshHoneypotConfig struct {
+	HostKey       string `yaml:"host-key"`       // 主机密钥（OpenSSH 私钥格式）的位置，文件不存在时自动生成，为空表示每次启动时生成临时密钥
+	ServerVersion string `yaml:"server-version"` // 发送给客户端的SSH标识行
+	MaxSockets    int64  `yaml:"max-sockets"`    // 同时交给蜜罐处理的连接数上限（所有转发共享），超出时直接断开
+	MaxDuration   string `yaml:"max-duration"`   // 单个连接最长时长
+	MaxAuthTries  int64  `yaml:"max-auth-tries"` // 单个连接最多尝试认证的次数
+
+	BanAttempts int64  `yaml:"ban-attempts"` // 单个连接尝试认证的次数达到该值时，将IP写入 SQLite 封禁，0 表示不封禁
+	BanDuration string `yaml:"ban-duration"` // 封禁时长，forever 表示永久封禁
+
+	MaxDurationDuration time.Duration `yaml:"-"`
+	BanDurationDuration time.Duration `yaml:"-"`
+}
+
+func (s *SshHoneypotConfig) setDefault() {
+	if s.ServerVersion == "" {
+		s.ServerVersion = "SSH-2.0-OpenSSH_9.6p1 Ubuntu-3ubuntu13.5"
+	}
+
+	if s.MaxSockets == 0 {
+		s.MaxSockets = 256
+	}
+
+	if s.MaxDuration == "" {
+		s.MaxDuration = "120s"
+	}
+
+	if s.MaxAuthTries == 0 {
+		s.MaxAuthTries = 6
+	}
+
+	if s.BanDuration == "" {
+		s.BanDuration = "7D"
+	}
+
+	return
+}
+
+func (s *SshHoneypotConfig) check() (err ConfigError) {
+	if !strings.HasPrefix(s.ServerVersion, "SSH-2.0-") {
+		return NewConfigError("bad honeypot server-version, must start with SSH-2.0-")
+	}
+
+	if s.MaxSockets < 0 {
+		return NewConfigError("bad honeypot max-sockets")
+	}
+
+	s.MaxDurationDuration = utils.ReadTimeDuration(s.MaxDuration)
+	if s.MaxDurationDuration < time.Second {
+		return NewConfigError("bad honeypot max-duration, must more than 1 second")
+	}
+
+	if s.MaxAuthTries <= 0 {
+		return NewConfigError("bad honeypot max-auth-tries")
+	}
+
+	if s.BanAttempts < 0 {
+		return NewConfigError("bad honeypot ban-attempts")
+	}
+
+	s.BanDurationDuration = utils.ReadTimeDuration(s.BanDuration)
+	if s.BanDurationDuration == 0 {
+		return NewConfigError("bad honeypot ban-duration")
+	}
+
+	if s.HostKey == "" {
+		_ = NewConfigWarning("honeypot host-key is empty, a temporary host key will be generated at every start")
+	}
+
+	return nil
+}
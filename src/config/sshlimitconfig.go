@@ -0,0 +1,27 @@
+package config
+
+type SshLimitConfig struct {
+	MaxSessions            int64 `yaml:"max-sessions"`              // 该转发同时存在的会话数上限
+	MaxSessionsPerIP       int64 `yaml:"max-sessions-per-ip"`       // 单个来源IP同时存在的会话数上限
+	MaxSessionsPerIPv6Net  int64 `yaml:"max-sessions-per-ipv6-net"` // 单个IPv6 /64 网段同时存在的会话数上限
+	MaxSessionsPerNation   int64 `yaml:"max-sessions-per-nation"`   // 单个国家同时存在的会话数上限
+	MaxSessionsPerProvince int64 `yaml:"max-sessions-per-province"` // 单个省份同时存在的会话数上限
+	MaxSessionsPerISP      int64 `yaml:"max-sessions-per-isp"`      // 单个ISP同时存在的会话数上限
+}
+
+func (s *SshLimitConfig) setDefault() {
+	return
+}
+
+func (s *SshLimitConfig) check() (err ConfigError) {
+	if s.MaxSessions < 0 || s.MaxSessionsPerIP < 0 || s.MaxSessionsPerIPv6Net < 0 ||
+		s.MaxSessionsPerNation < 0 || s.MaxSessionsPerProvince < 0 || s.MaxSessionsPerISP < 0 {
+		return NewConfigError("session limit must not be less than 0")
+	}
+
+	if s.MaxSessions > 0 && s.MaxSessionsPerIP > s.MaxSessions {
+		_ = NewConfigWarning("max-sessions-per-ip is greater than max-sessions")
+	}
+
+	return nil
+}
@@ -0,0 +1,49 @@
+package config
+
+import (
+	"fmt"
+	"github.com/SongZihuan/ssh-watcher/src/utils"
+	"strings"
+)
+
+const preBannerMaxLine = 253 // 加上结尾的 CRLF 不超过 255 字节
+
+type SshMaintenanceConfig struct {
+	Enable  utils.StringBool `yaml:"enable"`  // 维护模式：通过检查的客户端只会收到提示信息，不连接回源地址
+	Message string           `yaml:"message"` // 提示信息，可以有多行
+}
+
+func (s *SshMaintenanceConfig) setDefault() {
+	s.Enable.SetDefaultDisable()
+
+	if s.Message == "" {
+		s.Message = "This server is down for maintenance, please try again later."
+	}
+
+	return
+}
+
+func (s *SshMaintenanceConfig) check() (err ConfigError) {
+	return checkPreBanner("maintenance message", s.Message)
+}
+
+func (s *SshMaintenanceConfig) IsEnable() bool {
+	return s.Enable.IsEnable(false)
+}
+
+// checkPreBanner 检查在SSH标识行之前发送给客户端的提示信息（RFC 4253 4.2），每行不能以 SSH- 开头，且不能过长
+func checkPreBanner(name string, message string) ConfigError {
+	for _, line := range strings.Split(message, "\n") {
+		line = strings.TrimSuffix(line, "\r")
+
+		if strings.HasPrefix(line, "SSH-") {
+			return NewConfigError(fmt.Sprintf("bad %s: line must not start with SSH-", name))
+		}
+
+		if len(line) > preBannerMaxLine {
+			return NewConfigError(fmt.Sprintf("bad %s: line must not be longer than %d bytes", name, preBannerMaxLine))
+		}
+	}
+
+	return nil
+}
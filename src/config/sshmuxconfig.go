@@ -0,0 +1,144 @@
+package config
+
+import (
+	"fmt"
+	"github.com/SongZihuan/ssh-watcher/src/utils"
+	"strings"
+	"time"
+)
+
+const (
+	MuxProtocolSSH   = "ssh"
+	MuxProtocolTLS   = "tls"
+	MuxProtocolHTTP  = "http"
+	MuxProtocolOther = "other" // 无法识别的协议，包括在 peek-timeout 内没有发送数据的客户端（服务器先发言的协议）
+)
+
+type SshMuxConfig struct {
+	Enable      utils.StringBool     `yaml:"enable"`
+	PeekTimeout string               `yaml:"peek-timeout"` // 等待客户端发送开头数据的最长时长
+	Routes      []*SshMuxRouteConfig `yaml:"routes"`       // 按顺序匹配，SSH 连接总是转发到转发本身的回源地址
+
+	PeekTimeoutDuration time.Duration `yaml:"-"`
+}
+
+type SshMuxRouteConfig struct {
+	Protocol     string           `yaml:"protocol"` // tls, http, other
+	SNI          []string         `yaml:"sni"`      // 仅 tls：TLS ClientHello 中的服务器名称，*.example.com 匹配其下的所有子域名，为空表示全部
+	Dest         string           `yaml:"dest"`     // TCP 地址，或者 unix: 开头的 Unix 套接字路径
+	Proxy        utils.StringBool `yaml:"proxy"`    // 向回源地址发送 Proxy 协议头部
+	ProxyVersion int              `yaml:"proxy-version"`
+
+	Backend SshBackendConfig `yaml:"-"` // 解析后的回源地址
+}
+
+func (s *SshMuxConfig) setDefault() {
+	s.Enable.SetDefaultDisable()
+
+	if s.PeekTimeout == "" {
+		s.PeekTimeout = "3s"
+	}
+
+	for _, r := range s.Routes {
+		r.setDefault()
+	}
+
+	return
+}
+
+func (s *SshMuxConfig) check() (err ConfigError) {
+	s.PeekTimeoutDuration = utils.ReadTimeDuration(s.PeekTimeout)
+	if s.PeekTimeoutDuration <= 0 {
+		return NewConfigError("bad mux peek-timeout")
+	}
+
+	if !s.IsEnable() {
+		return nil
+	}
+
+	for _, r := range s.Routes {
+		err := r.check()
+		if err != nil && err.IsError() {
+			return err
+		}
+	}
+
+	if len(s.Routes) == 0 {
+		_ = NewConfigWarning("mux is enabled without routes, only ssh connections will be forwarded")
+	}
+
+	return nil
+}
+
+func (s *SshMuxConfig) IsEnable() bool {
+	return s.Enable.IsEnable(false)
+}
+
+// Match 返回第一个匹配协议（和服务器名称）的转发目标的序号，没有匹配时返回 -1
+func (s *SshMuxConfig) Match(protocol string, sni string) int {
+	for i, r := range s.Routes {
+		if r.Protocol == protocol && r.matchSNI(sni) {
+			return i
+		}
+	}
+
+	return -1
+}
+
+func (s *SshMuxRouteConfig) setDefault() {
+	s.Proxy.SetDefaultDisable()
+
+	if s.ProxyVersion <= 0 && s.ProxyVersion != -1 { // -1 表示使用最新版; 0 表示默认（使用版本1）
+		s.ProxyVersion = 1
+	}
+
+	return
+}
+
+func (s *SshMuxRouteConfig) check() (err ConfigError) {
+	switch s.Protocol {
+	case MuxProtocolTLS, MuxProtocolHTTP, MuxProtocolOther:
+	case MuxProtocolSSH:
+		return NewConfigError("mux route protocol ssh is not allowed, ssh connections are forwarded to dest or backends")
+	default:
+		return NewConfigError(fmt.Sprintf("bad mux route protocol: %s", s.Protocol))
+	}
+
+	if len(s.SNI) > 0 && s.Protocol != MuxProtocolTLS {
+		_ = NewConfigWarning(fmt.Sprintf("mux route %s: sni only works with protocol tls, it will be ignored", s.Dest))
+	}
+
+	for i, name := range s.SNI {
+		s.SNI[i] = strings.ToLower(strings.TrimSuffix(strings.TrimSpace(name), "."))
+		if s.SNI[i] == "" || s.SNI[i] == "*." {
+			return NewConfigError(fmt.Sprintf("mux route %s: bad sni %s", s.Dest, name))
+		}
+	}
+
+	if s.Dest == "" {
+		return NewConfigError("mux route dest is empty")
+	}
+
+	s.Backend = SshBackendConfig{Address: s.Dest}
+	s.Backend.setDefault()
+	return s.Backend.check()
+}
+
+// matchSNI 检查服务器名称（已转为小写）是否匹配，非 tls 的转发目标总是匹配
+func (s *SshMuxRouteConfig) matchSNI(sni string) bool {
+	if s.Protocol != MuxProtocolTLS || len(s.SNI) == 0 {
+		return true
+	}
+
+	for _, name := range s.SNI {
+		if suffix, ok := strings.CutPrefix(name, "*"); ok {
+			if strings.HasSuffix(sni, suffix) && len(sni) > len(suffix) {
+				return true
+			}
+		} else if sni == name {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,98 @@
+package config
+
+import (
+	"fmt"
+	"github.com/SongZihuan/ssh-watcher/src/utils"
+	"time"
+)
+
+type SshConnRateConfig struct {
+	Count  int64  `yaml:"count"`  // 每个时间段内允许的新连接数（同时也是允许的突发连接数），0 表示不限制
+	Period string `yaml:"period"` // 时间段
+
+	PeriodDuration time.Duration `yaml:"-"`
+}
+
+func (s *SshConnRateConfig) setDefault() {
+	if s.Period == "" {
+		s.Period = "60s"
+	}
+
+	return
+}
+
+func (s *SshConnRateConfig) check(name string) (err ConfigError) {
+	if s.Count < 0 {
+		return NewConfigError(fmt.Sprintf("rate-limit %s count must not be less than 0", name))
+	}
+
+	s.PeriodDuration = utils.ReadTimeDuration(s.Period)
+	if s.PeriodDuration <= 0 {
+		return NewConfigError(fmt.Sprintf("bad rate-limit %s period", name))
+	}
+
+	return nil
+}
+
+func (s *SshConnRateConfig) IsEnable() bool {
+	return s.Count > 0
+}
+
+type SshRateLimitConfig struct {
+	IP     SshConnRateConfig `yaml:"ip"`     // 每个来源IP
+	Net    SshConnRateConfig `yaml:"net"`    // 每个来源网段（IPv4 /24，IPv6 /64）
+	Global SshConnRateConfig `yaml:"global"` // 该转发的全部新连接
+
+	SummaryInterval   string `yaml:"summary-interval"`    // 汇总被丢弃的连接并写入数据库的间隔
+	SummaryMaxRecords int64  `yaml:"summary-max-records"` // 每次汇总最多写入的记录数，丢弃最多的来源优先，其余的合并为一条
+
+	SummaryIntervalDuration time.Duration `yaml:"-"`
+}
+
+func (s *SshRateLimitConfig) setDefault() {
+	s.IP.setDefault()
+	s.Net.setDefault()
+	s.Global.setDefault()
+
+	if s.SummaryInterval == "" {
+		s.SummaryInterval = "60s"
+	}
+
+	if s.SummaryMaxRecords == 0 {
+		s.SummaryMaxRecords = 20
+	}
+
+	return
+}
+
+func (s *SshRateLimitConfig) check() (err ConfigError) {
+	err = s.IP.check("ip")
+	if err != nil && err.IsError() {
+		return err
+	}
+
+	err = s.Net.check("net")
+	if err != nil && err.IsError() {
+		return err
+	}
+
+	err = s.Global.check("global")
+	if err != nil && err.IsError() {
+		return err
+	}
+
+	s.SummaryIntervalDuration = utils.ReadTimeDuration(s.SummaryInterval)
+	if s.SummaryIntervalDuration <= 0 {
+		return NewConfigError("bad rate-limit summary-interval")
+	}
+
+	if s.SummaryMaxRecords < 1 {
+		return NewConfigError("rate-limit summary-max-records must be greater than 0")
+	}
+
+	return nil
+}
+
+func (s *SshRateLimitConfig) IsEnable() bool {
+	return s.IP.IsEnable() || s.Net.IsEnable() || s.Global.IsEnable()
+}
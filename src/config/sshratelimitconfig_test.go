@@ -0,0 +1,26 @@
+package config
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSshRateLimitConfigDefault(t *testing.T) {
+	var cfg SshRateLimitConfig
+	cfg.setDefault()
+
+	err := cfg.check()
+	if err != nil && err.IsError() {
+		t.Fatalf("check default rate-limit config: %s", err.Error())
+	}
+
+	for name, r := range map[string]*SshConnRateConfig{"ip": &cfg.IP, "net": &cfg.Net, "global": &cfg.Global} {
+		if r.PeriodDuration != time.Minute {
+			t.Errorf("default %s period is %s, want %s", name, r.PeriodDuration, time.Minute)
+		}
+	}
+
+	if cfg.SummaryIntervalDuration != time.Minute {
+		t.Errorf("default summary-interval is %s, want %s", cfg.SummaryIntervalDuration, time.Minute)
+	}
+}
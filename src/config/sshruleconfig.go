@@ -1,11 +1,31 @@
 package config
 
+import (
+	"regexp"
+	"strings"
+)
+
 type SshRuleConfig struct {
 	RuleConfig `yaml:",inline"`
+
+	ClientVersion      string `yaml:"client-version"`       // 客户端SSH标识行（例如 SSH-2.0-OpenSSH_9.6）的正则表达式
+	ClientVersionVague string `yaml:"client-version-vague"` // 客户端SSH标识行包含该字符串（不区分大小写）
+	HASSH              string `yaml:"hassh"`                // 客户端密钥交换的 HASSH 指纹
+
+	Action    string             `yaml:"action"`    // 封禁时对连接的处理方式：reject、tarpit 或 honeypot
+	Message   string             `yaml:"message"`   // 封禁（action 为 reject）时在断开前发送给客户端的提示信息，为空表示直接断开
+	Bandwidth SshBandwidthConfig `yaml:"bandwidth"` // 命中该规则的所有会话共享的限速（仅对允许连接的规则有效）
+
+	ClientVersionRegexp *regexp.Regexp `yaml:"-"`
 }
 
 func (s *SshRuleConfig) setDefault() {
 	s.RuleConfig.setDefault()
+	s.Bandwidth.setDefault()
+
+	if s.Action == "" {
+		s.Action = ActionReject
+	}
 
 	return
 }
@@ -16,5 +36,97 @@ func (s *SshRuleConfig) check() (err ConfigError) {
 		return err
 	}
 
+	if s.ClientVersion != "" {
+		var reErr error
+		s.ClientVersionRegexp, reErr = regexp.Compile(s.ClientVersion)
+		if reErr != nil {
+			return NewConfigError("bad client-version: " + reErr.Error())
+		}
+	}
+
+	s.HASSH = strings.ToLower(s.HASSH)
+	if s.HASSH != "" && len(s.HASSH) != 32 {
+		return NewConfigError("bad hassh")
+	}
+
+	if !s.HasIP() && !s.HasClientVersion() && !s.HasHASSH() {
+		return NewConfigError("bad IP or CIDR")
+	}
+
+	if s.HasHASSH() && !s.Banned.ToBool(true) {
+		_ = NewConfigWarning("rule with hassh is only checked after the connection is established, banned: disable will be ignored")
+	}
+
+	err = checkAction(s.Action)
+	if err != nil && err.IsError() {
+		return err
+	}
+
+	err = s.Bandwidth.check()
+	if err != nil && err.IsError() {
+		return err
+	}
+
+	err = checkPreBanner("rule message", s.Message)
+	if err != nil && err.IsError() {
+		return err
+	}
+
+	if s.Message != "" && (!s.Banned.ToBool(true) || s.Action != ActionReject || s.HasHASSH()) {
+		_ = NewConfigWarning("message is only sent by banned rules with action reject and without hassh, it will be ignored")
+	}
+
+	if s.Bandwidth.IsEnable() && s.Banned.ToBool(true) {
+		_ = NewConfigWarning("rule is banned, bandwidth will be ignored")
+	}
+
 	return nil
 }
+
+func (s *SshRuleConfig) HasClientVersion() bool {
+	return s.ClientVersion != "" || s.ClientVersionVague != ""
+}
+
+func (s *SshRuleConfig) HasHASSH() bool {
+	return s.HASSH != ""
+}
+
+func (s *SshRuleConfig) CheckHASSH(hassh string) bool {
+	return hassh != "" && s.HASSH == hassh
+}
+
+// CheckClientVersion 检查客户端标识行是否命中规则，未读取到标识行（例如未启用 header-check）时不命中
+func (s *SshRuleConfig) CheckClientVersion(clientVersion string) bool {
+	if clientVersion == "" {
+		return false
+	}
+
+	if s.ClientVersionRegexp != nil && !s.ClientVersionRegexp.MatchString(clientVersion) {
+		return false
+	}
+
+	if s.ClientVersionVague != "" && !strings.Contains(strings.ToLower(clientVersion), strings.ToLower(s.ClientVersionVague)) {
+		return false
+	}
+
+	return true
+}
+
+// String 规则的匹配条件，用于日志和 Proxy 协议头部
+func (s *SshRuleConfig) String() string {
+	conditions := s.Conditions()
+
+	if s.ClientVersion != "" {
+		conditions = append(conditions, "client-version="+s.ClientVersion)
+	}
+
+	if s.ClientVersionVague != "" {
+		conditions = append(conditions, "client-version-vague="+s.ClientVersionVague)
+	}
+
+	if s.HASSH != "" {
+		conditions = append(conditions, "hassh="+s.HASSH)
+	}
+
+	return strings.Join(conditions, " ")
+}
@@ -5,9 +5,11 @@ import "github.com/SongZihuan/ssh-watcher/src/utils"
 type SshRuleListConfig struct {
 	RuleList []*SshRuleConfig `yaml:"rules"`
 
-	DefaultBanned       utils.StringBool `yaml:"default-banned"`        // 默认（未名字规则）拒绝连接
-	AlwaysAllowIntranet utils.StringBool `yaml:"always-allow-intranet"` // 总是允许内网连接（配置 ip 数据库封禁除外）
-	AlwaysAllowLoopback utils.StringBool `yaml:"always-allow-loopback"` // 总是允许本地回环地址连接（不检查 ip 数据库封禁）
+	DefaultBanned        utils.StringBool `yaml:"default-banned"`         // 默认（未名字规则）拒绝连接
+	DefaultBannedAction  string           `yaml:"default-banned-action"`  // 默认拒绝连接时的处理方式：reject、tarpit 或 honeypot
+	DefaultBannedMessage string           `yaml:"default-banned-message"` // 默认拒绝连接（reject）时在断开前发送给客户端的提示信息，为空表示直接断开
+	AlwaysAllowIntranet  utils.StringBool `yaml:"always-allow-intranet"`  // 总是允许内网连接（配置 ip 数据库封禁除外）
+	AlwaysAllowLoopback  utils.StringBool `yaml:"always-allow-loopback"`  // 总是允许本地回环地址连接（不检查 ip 数据库封禁）
 }
 
 func (s *SshRuleListConfig) setDefault() {
@@ -16,6 +18,9 @@ func (s *SshRuleListConfig) setDefault() {
 	}
 
 	s.DefaultBanned.SetDefaultEnable()
+	if s.DefaultBannedAction == "" {
+		s.DefaultBannedAction = ActionReject
+	}
 	s.AlwaysAllowIntranet.SetDefaultDisable()
 	s.AlwaysAllowLoopback.SetDefaultEnable()
 
@@ -27,6 +32,16 @@ func (s *SshRuleListConfig) check() (err ConfigError) {
 		_ = NewConfigWarning("ssh recommends setting the default policy to banned")
 	}
 
+	err = checkAction(s.DefaultBannedAction)
+	if err != nil && err.IsError() {
+		return err
+	}
+
+	err = checkPreBanner("default-banned-message", s.DefaultBannedMessage)
+	if err != nil && err.IsError() {
+		return err
+	}
+
 	for _, r := range s.RuleList {
 		err := r.check()
 		if err != nil && err.IsError() {
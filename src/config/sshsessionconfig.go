@@ -0,0 +1,77 @@
+package config
+
+import (
+	"github.com/SongZihuan/ssh-watcher/src/utils"
+	"time"
+)
+
+type SshSessionConfig struct {
+	IdleTimeout     string `yaml:"idle-timeout"`      // 空闲超时（两个方向均没有数据），为空或0表示不限制
+	MaxSessionTime  string `yaml:"max-session-time"`  // 会话最长时长，为空或0表示不限制
+	HalfCloseLinger string `yaml:"half-close-linger"` // 一个方向结束（收到EOF）后，等待另一个方向结束的最长时长，0表示不等待，forever表示一直等待
+
+	TCPKeepAlive         utils.StringBool `yaml:"tcp-keepalive"`          // 客户端和回源连接是否启用 TCP keepalive
+	TCPKeepAliveIdle     string           `yaml:"tcp-keepalive-idle"`     // 空闲多久后开始发送探测，为空表示使用系统默认值
+	TCPKeepAliveInterval string           `yaml:"tcp-keepalive-interval"` // 探测间隔，为空表示使用系统默认值
+	TCPKeepAliveCount    int64            `yaml:"tcp-keepalive-count"`    // 探测失败多少次后断开，0表示使用系统默认值
+	TCPUserTimeout       string           `yaml:"tcp-user-timeout"`       // TCP_USER_TIMEOUT（仅Linux），为空表示使用系统默认值
+
+	IdleTimeoutDuration          time.Duration `yaml:"-"`
+	MaxSessionTimeDuration       time.Duration `yaml:"-"`
+	HalfCloseLingerDuration      time.Duration `yaml:"-"`
+	TCPKeepAliveIdleDuration     time.Duration `yaml:"-"`
+	TCPKeepAliveIntervalDuration time.Duration `yaml:"-"`
+	TCPUserTimeoutDuration       time.Duration `yaml:"-"`
+}
+
+func (s *SshSessionConfig) setDefault() {
+	if s.HalfCloseLinger == "" {
+		s.HalfCloseLinger = "30s"
+	}
+
+	s.TCPKeepAlive.SetDefaultEnable()
+	return
+}
+
+func (s *SshSessionConfig) check() (err ConfigError) {
+	s.IdleTimeoutDuration = utils.ReadTimeDuration(s.IdleTimeout)
+	if s.IdleTimeoutDuration < 0 {
+		s.IdleTimeoutDuration = 0 // forever 或 none 表示不限制
+	} else if s.IdleTimeoutDuration > 0 && s.IdleTimeoutDuration < time.Second {
+		return NewConfigError("bad idle-timeout, must more than 1 second")
+	}
+
+	s.MaxSessionTimeDuration = utils.ReadTimeDuration(s.MaxSessionTime)
+	if s.MaxSessionTimeDuration < 0 {
+		s.MaxSessionTimeDuration = 0
+	} else if s.MaxSessionTimeDuration > 0 && s.MaxSessionTimeDuration < time.Second {
+		return NewConfigError("bad max-session-time, must more than 1 second")
+	}
+
+	s.HalfCloseLingerDuration = utils.ReadTimeDuration(s.HalfCloseLinger) // forever 或 none 为 -1，表示一直等待
+
+	s.TCPKeepAliveIdleDuration = utils.ReadTimeDuration(s.TCPKeepAliveIdle)
+	if s.TCPKeepAliveIdleDuration < 0 {
+		return NewConfigError("bad tcp-keepalive-idle")
+	}
+
+	s.TCPKeepAliveIntervalDuration = utils.ReadTimeDuration(s.TCPKeepAliveInterval)
+	if s.TCPKeepAliveIntervalDuration < 0 {
+		return NewConfigError("bad tcp-keepalive-interval")
+	}
+
+	if s.TCPKeepAliveCount < 0 {
+		return NewConfigError("bad tcp-keepalive-count")
+	}
+
+	s.TCPUserTimeoutDuration = utils.ReadTimeDuration(s.TCPUserTimeout)
+	if s.TCPUserTimeoutDuration < 0 {
+		return NewConfigError("bad tcp-user-timeout")
+	}
+
+	if s.TCPKeepAlive.IsDisable(false) && (s.TCPKeepAliveIdleDuration > 0 || s.TCPKeepAliveIntervalDuration > 0 || s.TCPKeepAliveCount > 0) {
+		_ = NewConfigWarning("tcp-keepalive is disable, tcp-keepalive-idle, tcp-keepalive-interval and tcp-keepalive-count will be ignored")
+	}
+
+	return nil
+}
@@ -0,0 +1,111 @@
+package config
+
+import (
+	"fmt"
+	"net"
+	"strings"
+)
+
+const (
+	SrcProxyModeRequire = "require" // 必须发送 Proxy 协议头部，否则拒绝连接
+	SrcProxyModeUse     = "use"     // 发送了 Proxy 协议头部时使用其中的来源地址，否则使用套接字的对端地址
+	SrcProxyModeReject  = "reject"  // 不允许发送 Proxy 协议头部，发送时拒绝连接，否则使用套接字的对端地址
+	SrcProxyModeDeny    = "deny"    // 直接拒绝连接
+)
+
+// SshSrcProxyConfig 来访连接的 Proxy 协议头部的信任策略，需要启用 ipv4-src-proxy 或 ipv6-src-proxy
+type SshSrcProxyConfig struct {
+	Trusted []*SshSrcProxyTrustConfig `yaml:"trusted"` // 可信的上游（例如负载均衡），按顺序匹配套接字的对端地址
+	Default string                    `yaml:"default"` // 不在 trusted 中的来源的处理方式，trusted 为空时默认为 use，否则默认为 reject
+}
+
+type SshSrcProxyTrustConfig struct {
+	CIDR string `yaml:"cidr"` // 上游的地址或网段，例如 10.0.0.0/8 或 192.168.1.10
+	Mode string `yaml:"mode"` // require、use 或 reject，默认为 require
+
+	ResolveIPNet *net.IPNet `yaml:"-"`
+}
+
+func (s *SshSrcProxyConfig) setDefault() {
+	for _, t := range s.Trusted {
+		t.setDefault()
+	}
+
+	if s.Default == "" {
+		if len(s.Trusted) == 0 {
+			s.Default = SrcProxyModeUse // 与未设置信任策略时的行为一致
+		} else {
+			s.Default = SrcProxyModeReject
+		}
+	}
+
+	return
+}
+
+func (s *SshSrcProxyConfig) check(enable bool) (err ConfigError) {
+	for _, t := range s.Trusted {
+		err = t.check()
+		if err != nil && err.IsError() {
+			return err
+		}
+	}
+
+	if !isSrcProxyMode(s.Default) {
+		return NewConfigError(fmt.Sprintf("bad src-proxy default mode: %s", s.Default))
+	}
+
+	if enable && len(s.Trusted) == 0 && s.Default == SrcProxyModeUse {
+		_ = NewConfigWarning("src-proxy trusted is empty, any client can send a proxy header and choose its source address")
+	}
+
+	return nil
+}
+
+// Mode 按照套接字的对端地址返回 Proxy 协议头部的处理方式
+func (s *SshSrcProxyConfig) Mode(peer net.IP) string {
+	for _, t := range s.Trusted {
+		if t.ResolveIPNet.Contains(peer) {
+			return t.Mode
+		}
+	}
+
+	return s.Default
+}
+
+func (t *SshSrcProxyTrustConfig) setDefault() {
+	if t.Mode == "" {
+		t.Mode = SrcProxyModeRequire
+	}
+
+	return
+}
+
+func (t *SshSrcProxyTrustConfig) check() (err ConfigError) {
+	if t.Mode != SrcProxyModeRequire && t.Mode != SrcProxyModeUse && t.Mode != SrcProxyModeReject {
+		return NewConfigError(fmt.Sprintf("bad src-proxy trusted mode: %s", t.Mode))
+	}
+
+	cidr := t.CIDR
+	if !strings.Contains(cidr, "/") {
+		ip := net.ParseIP(cidr)
+		if ip == nil {
+			return NewConfigError(fmt.Sprintf("bad src-proxy trusted cidr: %s", t.CIDR))
+		} else if ip.To4() != nil {
+			cidr += "/32"
+		} else {
+			cidr += "/128"
+		}
+	}
+
+	_, ipnet, e := net.ParseCIDR(cidr)
+	if e != nil {
+		return NewConfigError(fmt.Sprintf("bad src-proxy trusted cidr: %s", t.CIDR))
+	}
+
+	t.ResolveIPNet = ipnet
+	return nil
+}
+
+func isSrcProxyMode(mode string) bool {
+	return mode == SrcProxyModeRequire || mode == SrcProxyModeUse || mode == SrcProxyModeReject || mode == SrcProxyModeDeny
+}
@@ -0,0 +1,60 @@
+package config
+
+import (
+	"github.com/SongZihuan/ssh-watcher/src/utils"
+	"time"
+)
+
+type SshTarpitConfig struct {
+	MaxSockets  int64  `yaml:"max-sockets"`  // 同时拖延的连接数上限（所有转发共享），超出时直接断开
+	Interval    string `yaml:"interval"`     // 发送前置行的间隔
+	MaxDuration string `yaml:"max-duration"` // 单个连接最长拖延时长，forever 表示不限制
+	LineLength  int64  `yaml:"line-length"`  // 每行随机内容的最大长度
+
+	IntervalDuration    time.Duration `yaml:"-"`
+	MaxDurationDuration time.Duration `yaml:"-"`
+}
+
+func (s *SshTarpitConfig) setDefault() {
+	if s.MaxSockets == 0 {
+		s.MaxSockets = 1024
+	}
+
+	if s.Interval == "" {
+		s.Interval = "10s"
+	}
+
+	if s.MaxDuration == "" {
+		s.MaxDuration = "1h"
+	}
+
+	if s.LineLength == 0 {
+		s.LineLength = 32
+	}
+
+	return
+}
+
+func (s *SshTarpitConfig) check() (err ConfigError) {
+	if s.MaxSockets < 0 {
+		return NewConfigError("bad tarpit max-sockets")
+	}
+
+	s.IntervalDuration = utils.ReadTimeDuration(s.Interval)
+	if s.IntervalDuration < time.Second {
+		return NewConfigError("bad tarpit interval, must more than 1 second")
+	}
+
+	s.MaxDurationDuration = utils.ReadTimeDuration(s.MaxDuration)
+	if s.MaxDurationDuration < 0 {
+		s.MaxDurationDuration = 0 // forever 或 none 表示不限制
+	} else if s.MaxDurationDuration == 0 {
+		return NewConfigError("bad tarpit max-duration")
+	}
+
+	if s.LineLength < 3 || s.LineLength > 253 { // RFC 4253：每行（包括 CR LF）最长 255 字节
+		return NewConfigError("bad tarpit line-length, must between 3 and 253")
+	}
+
+	return nil
+}
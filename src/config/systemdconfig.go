@@ -0,0 +1,34 @@
+package config
+
+import (
+	"github.com/SongZihuan/ssh-watcher/src/utils"
+	"time"
+)
+
+type SystemdConfig struct {
+	SocketActivation      utils.StringBool `yaml:"socket-activation"`       // 使用 systemd 套接字激活传入的监听（LISTEN_FDS），按名称对应到转发
+	Notify                utils.StringBool `yaml:"notify"`                  // 通过 NOTIFY_SOCKET 报告 READY、STOPPING 和 WATCHDOG 状态
+	WatchdogAcceptTimeout string           `yaml:"watchdog-accept-timeout"` // 单个连接占用 accept 循环超过该时长时视为卡住，不再发送 WATCHDOG
+
+	WatchdogAcceptTimeoutDuration time.Duration `yaml:"-"`
+}
+
+func (s *SystemdConfig) setDefault() {
+	s.SocketActivation.SetDefaultEnable()
+	s.Notify.SetDefaultEnable()
+
+	if s.WatchdogAcceptTimeout == "" {
+		s.WatchdogAcceptTimeout = "60s"
+	}
+
+	return
+}
+
+func (s *SystemdConfig) check() (err ConfigError) {
+	s.WatchdogAcceptTimeoutDuration = utils.ReadTimeDuration(s.WatchdogAcceptTimeout)
+	if s.WatchdogAcceptTimeoutDuration <= 0 {
+		return NewConfigError("bad systemd watchdog-accept-timeout")
+	}
+
+	return nil
+}
@@ -0,0 +1,37 @@
+package config
+
+import (
+	"github.com/SongZihuan/ssh-watcher/src/utils"
+	"time"
+)
+
+type UpgradeConfig struct {
+	ReadyTimeout string `yaml:"ready-timeout"` // 等待新进程启动完成的最长时长，超时后放弃升级，继续使用旧进程
+	DrainTimeout string `yaml:"drain-timeout"` // 升级后旧进程等待会话结束的最长时长，0 表示使用各转发的 drain-timeout，forever 表示一直等待
+
+	ReadyTimeoutDuration time.Duration `yaml:"-"`
+	DrainTimeoutDuration time.Duration `yaml:"-"` // 0 表示使用各转发的设定，小于 0 表示一直等待
+}
+
+func (u *UpgradeConfig) setDefault() {
+	if u.ReadyTimeout == "" {
+		u.ReadyTimeout = "30s"
+	}
+
+	if u.DrainTimeout == "" {
+		u.DrainTimeout = "12h" // 升级不应断开已有的会话，各转发的 drain-timeout 只适用于停止服务
+	}
+
+	return
+}
+
+func (u *UpgradeConfig) check() (err ConfigError) {
+	u.ReadyTimeoutDuration = utils.ReadTimeDuration(u.ReadyTimeout)
+	if u.ReadyTimeoutDuration <= 0 {
+		return NewConfigError("bad upgrade ready-timeout")
+	}
+
+	u.DrainTimeoutDuration = utils.ReadTimeDuration(u.DrainTimeout)
+
+	return nil
+}
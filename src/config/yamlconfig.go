@@ -8,11 +8,16 @@ import (
 type YamlConfig struct {
 	GlobalConfig `yaml:",inline"`
 
-	SSH    SshConfig    `yaml:"ssh"`
-	API    ApiConfig    `yaml:"api"`
-	SMTP   SMTPConfig   `yaml:"smtp"`
-	Redis  RedisConfig  `yaml:"redis"`
-	SQLite SQLiteConfig `yaml:"sqlite"`
+	SSH     SshConfig        `yaml:"ssh"`
+	API     ApiConfig        `yaml:"api"`
+	SMTP    SMTPConfig       `yaml:"smtp"`
+	Redis   RedisConfig      `yaml:"redis"`
+	SQLite  SQLiteConfig     `yaml:"sqlite"`
+	Reload  AutoReloadConfig `yaml:"reload"`
+	Systemd SystemdConfig    `yaml:"systemd"`
+	Upgrade UpgradeConfig    `yaml:"upgrade"`
+	Metrics MetricsConfig    `yaml:"metrics"`
+	Admin   AdminConfig      `yaml:"admin"`
 }
 
 func (y *YamlConfig) Init() error {
@@ -26,6 +31,11 @@ func (y *YamlConfig) setDefault() {
 	y.SMTP.setDefault()
 	y.Redis.setDefault()
 	y.SQLite.setDefault()
+	y.Reload.setDefault()
+	y.Systemd.setDefault()
+	y.Upgrade.setDefault()
+	y.Metrics.setDefault()
+	y.Admin.setDefault()
 }
 
 func (y *YamlConfig) check() (err ConfigError) {
@@ -59,6 +69,31 @@ func (y *YamlConfig) check() (err ConfigError) {
 		return err
 	}
 
+	err = y.Reload.check()
+	if err != nil && err.IsError() {
+		return err
+	}
+
+	err = y.Systemd.check()
+	if err != nil && err.IsError() {
+		return err
+	}
+
+	err = y.Upgrade.check()
+	if err != nil && err.IsError() {
+		return err
+	}
+
+	err = y.Metrics.check()
+	if err != nil && err.IsError() {
+		return err
+	}
+
+	err = y.Admin.check()
+	if err != nil && err.IsError() {
+		return err
+	}
+
 	return nil
 }
 
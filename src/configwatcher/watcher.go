@@ -0,0 +1,146 @@
+package configwatcher
+
+import (
+	"fmt"
+	"github.com/SongZihuan/ssh-watcher/src/config"
+	"github.com/SongZihuan/ssh-watcher/src/logger"
+	"github.com/fsnotify/fsnotify"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+)
+
+const (
+	StatusReady int32 = iota
+	StatusRunning
+	StatusStopping
+	StatusFinished
+)
+
+// Watcher 监听配置文件所在的目录（编辑器保存时常常是替换文件），配置文件变化时向信号通道发送 SIGHUP
+type Watcher struct {
+	status   atomic.Int32
+	watcher  *fsnotify.Watcher
+	path     string
+	delay    time.Duration
+	stopchan chan bool
+	swg      sync.WaitGroup
+}
+
+func NewWatcher() (*Watcher, error) {
+	if !config.IsReady() {
+		panic("config is not ready")
+	}
+
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, fmt.Errorf("new fsnotify watcher failed: %s", err.Error())
+	}
+
+	err = watcher.Add(config.GetConfigFileDir())
+	if err != nil {
+		_ = watcher.Close()
+		return nil, fmt.Errorf("watch %s failed: %s", config.GetConfigFileDir(), err.Error())
+	}
+
+	res := &Watcher{
+		watcher:  watcher,
+		path:     filepath.Clean(config.GetConfigPathFile()),
+		delay:    config.GetConfig().Reload.DelayDuration,
+		stopchan: make(chan bool),
+	}
+
+	res.status.Store(StatusReady)
+
+	return res, nil
+}
+
+func (w *Watcher) Start() error {
+	if w.status.Load() != StatusReady {
+		return nil
+	}
+
+	w.swg.Add(1)
+	go func() {
+		defer w.swg.Done()
+
+		defer func() {
+			r := recover()
+			if r != nil {
+				if err, ok := r.(error); ok {
+					logger.Panicf("Config watcher panic error: %s", err.Error())
+				} else {
+					logger.Panicf("Config watcher panic: %v", r)
+				}
+			}
+		}()
+
+		var timer *time.Timer
+		var timechan <-chan time.Time
+
+	MainCycle:
+		for {
+			select {
+			case <-w.stopchan:
+				break MainCycle
+			case event, ok := <-w.watcher.Events:
+				if !ok {
+					break MainCycle
+				}
+
+				if filepath.Clean(event.Name) != w.path || !event.Has(fsnotify.Write|fsnotify.Create|fsnotify.Rename) {
+					continue
+				}
+
+				// 短时间内的多次写入只重载一次
+				if timer == nil {
+					timer = time.NewTimer(w.delay)
+				} else {
+					timer.Reset(w.delay)
+				}
+				timechan = timer.C
+			case err, ok := <-w.watcher.Errors:
+				if !ok {
+					break MainCycle
+				}
+
+				logger.Errorf("config watcher error: %s", err.Error())
+			case <-timechan:
+				timechan = nil
+
+				logger.Infof("config file %s changed, reload", w.path)
+				select {
+				case config.GetSignalChan() <- syscall.SIGHUP:
+				case <-w.stopchan:
+					break MainCycle
+				}
+			}
+		}
+
+		if timer != nil {
+			timer.Stop()
+		}
+	}()
+
+	if !w.status.CompareAndSwap(StatusReady, StatusRunning) {
+		return fmt.Errorf("status error")
+	}
+
+	return nil
+}
+
+func (w *Watcher) Stop() error {
+	if !w.status.CompareAndSwap(StatusRunning, StatusStopping) {
+		return nil
+	}
+
+	close(w.stopchan)
+	w.swg.Wait()
+
+	_ = w.watcher.Close()
+
+	w.status.CompareAndSwap(StatusStopping, StatusFinished)
+	return nil
+}
@@ -50,8 +50,8 @@ func (c *Cleaner) Start() error {
 		return nil
 	}
 
+	c.swg.Add(1)
 	go func() {
-		c.swg.Add(1)
 		defer c.swg.Done()
 
 		defer func() {
@@ -86,8 +86,8 @@ func (c *Cleaner) Start() error {
 }
 
 func (c *Cleaner) clean() {
+	c.swg.Add(1)
 	go func() {
-		c.swg.Add(1)
 		defer c.swg.Done()
 
 		defer func() {
@@ -1,7 +1,9 @@
 package database
 
 import (
+	"crypto/rand"
 	"database/sql"
+	"encoding/hex"
 	"errors"
 	"fmt"
 	"github.com/SongZihuan/ssh-watcher/src/api/apiip"
@@ -130,7 +132,31 @@ func SshCheckLocationISP(isp string) bool {
 	return false
 }
 
-func AddSshConnectRecord(from string, fromIP net.IP, loc *apiip.QueryIpLocationData, to *net.TCPAddr, accept bool, t time.Time, mark string) (*SshConnectRecord, error) {
+func SshCheckHASSH(hassh string) bool {
+	if hassh == "" {
+		return true
+	}
+
+	var res SshBannedHASSH
+	err := db.Model(&SshBannedHASSH{}).Where("hassh = ?", hassh).Order("id desc").First(&res).Error
+	if err != nil && errors.Is(err, gorm.ErrRecordNotFound) {
+		return true
+	} else if err != nil {
+		logger.Errorf("CheckHASSH from DB failed: %s", err.Error())
+		return true
+	}
+
+	now := time.Now()
+	if res.StartAt.Valid && now.Before(res.StartAt.Time) {
+		return true // 未生效规则
+	} else if res.StopAt.Valid && now.After(res.StopAt.Time) {
+		return true // 已失效规则
+	}
+
+	return false
+}
+
+func AddSshConnectRecord(forward string, from string, fromIP net.IP, peer string, loc *apiip.QueryIpLocationData, clientVersion string, to string, accept bool, t time.Time, mark string) (*SshConnectRecord, error) {
 	if fromIP == nil {
 		fromIP = net.ParseIP(from)
 		if fromIP == nil {
@@ -151,11 +177,18 @@ func AddSshConnectRecord(from string, fromIP net.IP, loc *apiip.QueryIpLocationD
 	}
 
 	record := SshConnectRecord{
-		From:   fromIP.String(),
-		To:     to.String(),
-		Accept: accept,
-		Time:   t,
-		Mark:   mark,
+		Forward:  forward,
+		From:     fromIP.String(),
+		Peer:     peer,
+		UniqueID: newUniqueID(),
+		To:       to,
+		Accept:   accept,
+		Time:     t,
+		Mark:     mark,
+		ClientVersion: sql.NullString{
+			Valid:  clientVersion != "",
+			String: clientVersion,
+		},
 	}
 
 	if loc != nil {
@@ -188,7 +221,35 @@ func AddSshConnectRecord(from string, fromIP net.IP, loc *apiip.QueryIpLocationD
 	return &record, nil
 }
 
-func UpdateSshConnectRecord(record *SshConnectRecord, mark string) (err error) {
+// RejectSshConnectRecord 已记录为允许的连接在开始转发前失败，改为拒绝
+func RejectSshConnectRecord(record *SshConnectRecord, mark string) error {
+	if record == nil {
+		return fmt.Errorf("record is nil")
+	}
+
+	if mark != "" && !strings.HasSuffix(mark, "。") {
+		mark += "。"
+	}
+
+	record.Accept = false
+	record.Mark = mark
+
+	return db.Save(record).Error // record已经是指针
+}
+
+// newUniqueID 随机生成 32 位十六进制的唯一 ID
+func newUniqueID() string {
+	var buf [16]byte
+	_, err := rand.Read(buf[:])
+	if err != nil {
+		return ""
+	}
+
+	return hex.EncodeToString(buf[:])
+}
+
+// UpdateSshConnectRecord 连接结束时记录流量、结束原因的分类（cause）和备注
+func UpdateSshConnectRecord(record *SshConnectRecord, upload int64, download int64, cause string, mark string) (err error) {
 	defer func() {
 		// 有除法，防止零除
 		r := recover()
@@ -214,6 +275,21 @@ func UpdateSshConnectRecord(record *SshConnectRecord, mark string) (err error) {
 		Int64: int64(time.Since(record.Time) / time.Millisecond),
 	}
 
+	record.UploadBytes = sql.NullInt64{
+		Valid: true,
+		Int64: upload,
+	}
+
+	record.DownloadBytes = sql.NullInt64{
+		Valid: true,
+		Int64: download,
+	}
+
+	record.DisconnectCause = sql.NullString{
+		Valid:  cause != "",
+		String: cause,
+	}
+
 	record.Mark = record.Mark + mark
 
 	err = db.Save(record).Error // record已经是指针
@@ -224,7 +300,7 @@ func UpdateSshConnectRecord(record *SshConnectRecord, mark string) (err error) {
 	return nil
 }
 
-func FindSshConnectRecord(from string, fromIP net.IP, to *net.TCPAddr, limit int, after time.Time) ([]SshConnectRecord, error) {
+func FindSshConnectRecord(forward string, from string, fromIP net.IP, limit int, after time.Time) ([]SshConnectRecord, error) {
 	var res []SshConnectRecord
 
 	if fromIP == nil {
@@ -242,7 +318,36 @@ func FindSshConnectRecord(from string, fromIP net.IP, to *net.TCPAddr, limit int
 		}
 	}
 
-	err := db.Model(&SshConnectRecord{}).Where("`time` > ? AND `to` = ? AND `from` = ?", after, to.String(), fromIP.String()).Order("time asc").Limit(limit).Find(&res).Error
+	err := db.Model(&SshConnectRecord{}).Where("`time` > ? AND `forward` = ? AND `from` = ?", after, forward, fromIP.String()).Order("time asc").Limit(limit).Find(&res).Error
+	if err != nil {
+		return nil, err
+	}
+
+	return res, nil
+}
+
+func UpdateSshConnectRecordHASSH(record *SshConnectRecord, hassh string, algorithms string) error {
+	if record == nil {
+		return fmt.Errorf("record is nil")
+	}
+
+	record.HASSH = sql.NullString{
+		Valid:  hassh != "",
+		String: hassh,
+	}
+
+	record.HASSHAlgorithms = sql.NullString{
+		Valid:  algorithms != "",
+		String: algorithms,
+	}
+
+	return db.Save(record).Error // record已经是指针
+}
+
+func FindSshConnectRecordByHASSH(forward string, hassh string, limit int, after time.Time) ([]SshConnectRecord, error) {
+	var res []SshConnectRecord
+
+	err := db.Model(&SshConnectRecord{}).Where("`time` > ? AND `forward` = ? AND `hassh` = ?", after, forward, hassh).Order("time asc").Limit(limit).Find(&res).Error
 	if err != nil {
 		return nil, err
 	}
@@ -250,6 +355,70 @@ func FindSshConnectRecord(from string, fromIP net.IP, to *net.TCPAddr, limit int
 	return res, nil
 }
 
+func SumSshConnectRecordBytes(forward string, fromIP net.IP, after time.Time) (int64, error) {
+	var res sql.NullInt64
+
+	err := db.Model(&SshConnectRecord{}).Select("SUM(IFNULL(`upload_bytes`, 0) + IFNULL(`download_bytes`, 0))").Where("`time` > ? AND `forward` = ? AND `from` = ?", after, forward, fromIP.String()).Scan(&res).Error
+	if err != nil {
+		return 0, err
+	}
+
+	return res.Int64, nil
+}
+
+func AddSshTarpitStat(ip string, duration time.Duration) error {
+	ms := int64(duration / time.Millisecond)
+
+	return db.Transaction(func(tx *gorm.DB) error {
+		var res SshTarpitStat
+		err := tx.Model(&SshTarpitStat{}).Where("ip = ?", ip).First(&res).Error
+		if err != nil && errors.Is(err, gorm.ErrRecordNotFound) {
+			res = SshTarpitStat{
+				IP: ip,
+			}
+		} else if err != nil {
+			return err
+		}
+
+		res.Count += 1
+		res.TotalTime += ms
+		if ms > res.MaxTime {
+			res.MaxTime = ms
+		}
+		res.LastTime = time.Now()
+
+		return tx.Save(&res).Error
+	})
+}
+
+func AddSshHoneypotAttempt(attempt *SshHoneypotAttempt) error {
+	return db.Create(attempt).Error
+}
+
+func AddSshRateLimitRecords(records []*SshRateLimitRecord) error {
+	if len(records) == 0 {
+		return nil
+	}
+
+	return db.Create(records).Error
+}
+
+func AddSshBannedIP(ip string, start time.Time, stop time.Time) error {
+	res := SshBannedIP{
+		IP: ip,
+		StartAt: sql.NullTime{
+			Valid: !start.IsZero(),
+			Time:  start,
+		},
+		StopAt: sql.NullTime{
+			Valid: !stop.IsZero(),
+			Time:  stop,
+		},
+	}
+
+	return db.Create(&res).Error
+}
+
 func CleanSshConnectRecord(keep time.Duration) error {
 	dl := time.Now().Add(-1 * keep)
 	err := db.Unscoped().Model(&SshConnectRecord{}).Where("`time` < ?", dl).Delete(&SshConnectRecord{}).Error
@@ -257,5 +426,15 @@ func CleanSshConnectRecord(keep time.Duration) error {
 		return err
 	}
 
+	err = db.Unscoped().Model(&SshHoneypotAttempt{}).Where("`time` < ?", dl).Delete(&SshHoneypotAttempt{}).Error
+	if err != nil {
+		return err
+	}
+
+	err = db.Unscoped().Model(&SshRateLimitRecord{}).Where("`time` < ?", dl).Delete(&SshRateLimitRecord{}).Error
+	if err != nil {
+		return err
+	}
+
 	return nil
 }
@@ -23,7 +23,7 @@ func InitSQLite() error {
 
 	err = _db.AutoMigrate(&SshBannedIP{}, &SshBannedLocationNation{},
 		&SshBannedLocationProvince{}, &SshBannedLocationCity{},
-		&SshBannedLocationISP{}, &SshConnectRecord{})
+		&SshBannedLocationISP{}, &SshBannedHASSH{}, &SshTarpitStat{}, &SshHoneypotAttempt{}, &SshRateLimitRecord{}, &SshConnectRecord{})
 	if err != nil {
 		return fmt.Errorf("auto migrate sqlite (%s) failed: %s", config.GetConfig().SQLite.Path, err)
 	}
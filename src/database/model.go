@@ -65,16 +65,94 @@ func (*SshBannedLocationISP) TableName() string {
 	return "ssh_banned_location_isp"
 }
 
+type SshBannedHASSH struct {
+	Model
+	HASSH   string       `gorm:"column:hassh;type:VARCHAR(32);not null;"`
+	StartAt sql.NullTime `gorm:"column:start_at;"`
+	StopAt  sql.NullTime `gorm:"column:stop_at;"`
+}
+
+func (*SshBannedHASSH) TableName() string {
+	return "ssh_banned_hassh"
+}
+
+type SshTarpitStat struct {
+	Model
+	IP        string    `gorm:"column:ip;type:VARCHAR(50);not null;uniqueIndex;"`
+	Count     int64     `gorm:"column:count;not null;default:0;"`      // 被拖延的连接数
+	TotalTime int64     `gorm:"column:total_time;not null;default:0;"` // 累计拖延时长，单位：毫秒（Millisecond）
+	MaxTime   int64     `gorm:"column:max_time;not null;default:0;"`   // 单个连接最长拖延时长，单位：毫秒（Millisecond）
+	LastTime  time.Time `gorm:"column:last_time;not null;"`            // 最后一次拖延结束的时间
+}
+
+func (*SshTarpitStat) TableName() string {
+	return "ssh_tarpit_stat"
+}
+
+type SshHoneypotAttempt struct {
+	Model
+	RecordID             uint           `gorm:"column:record_id;not null;index;"` // 对应的 SshConnectRecord
+	Forward              string         `gorm:"column:forward;type:VARCHAR(50);not null;default:'';"`
+	IP                   string         `gorm:"column:ip;type:VARCHAR(50);not null;index;"`
+	ClientVersion        sql.NullString `gorm:"column:client_version;type:VARCHAR(255);"`
+	User                 string         `gorm:"column:user;type:VARCHAR(255);not null;"`
+	Method               string         `gorm:"column:method;type:VARCHAR(30);not null;"` // password、publickey 或 keyboard-interactive
+	Password             sql.NullString `gorm:"column:password;type:VARCHAR(255);"`
+	PublicKeyType        sql.NullString `gorm:"column:public_key_type;type:VARCHAR(50);"`
+	PublicKeyFingerprint sql.NullString `gorm:"column:public_key_fingerprint;type:VARCHAR(100);"` // SHA256 指纹
+	Time                 time.Time      `gorm:"column:time;not null;"`
+}
+
+func (*SshHoneypotAttempt) TableName() string {
+	return "ssh_honeypot_attempt"
+}
+
+// SshRateLimitRecord 一个汇总周期内因速率限制被丢弃的连接，按来源汇总
+type SshRateLimitRecord struct {
+	Model
+	Forward string    `gorm:"column:forward;type:VARCHAR(50);not null;default:'';"`
+	Scope   string    `gorm:"column:scope;type:VARCHAR(10);not null;"`  // 触发的限制：ip、net 或 global
+	Source  string    `gorm:"column:source;type:VARCHAR(50);not null;"` // 来源IP或网段，global 为空，超出记录数上限的其他来源合并为 *
+	Count   int64     `gorm:"column:count;not null;default:0;"`         // 被丢弃的连接数
+	StartAt time.Time `gorm:"column:start_at;not null;"`                // 汇总周期的开始时间
+	Time    time.Time `gorm:"column:time;not null;index;"`              // 汇总周期的结束时间
+}
+
+func (*SshRateLimitRecord) TableName() string {
+	return "ssh_rate_limit_record"
+}
+
 type SshConnectRecord struct {
 	Model
-	From          string         `gorm:"column:from;type:VARCHAR(50);not null;"`
-	Nation        sql.NullString `gorm:"column:nation;type:VARCHAR(50);"`
-	Province      sql.NullString `gorm:"column:province;type:VARCHAR(50);"`
-	City          sql.NullString `gorm:"column:city;type:VARCHAR(50);"`
-	ISP           sql.NullString `gorm:"column:isp;type:VARCHAR(50);"`
-	To            string         `gorm:"column:to;type:VARCHAR(50);not null;"`
-	Accept        bool           `gorm:"column:accept;not null;"`
-	Time          time.Time      `gorm:"column:time;not null;"`
-	TimeConsuming sql.NullInt64  `gorm:"column:time_consuming;"` // 单位：毫秒（Millisecond）
-	Mark          string         `gorm:"column:mark;type:VARCHAR(200);not null;"`
+	Forward         string         `gorm:"column:forward;type:VARCHAR(50);not null;default:'';"`
+	From            string         `gorm:"column:from;type:VARCHAR(50);not null;"`            // 来访IP，使用 Proxy 协议时为头部中声明的来源
+	Peer            string         `gorm:"column:peer;type:VARCHAR(60);not null;default:'';"` // 套接字的对端地址（IP:端口），使用 Proxy 协议时为上游代理的地址
+	UniqueID        string         `gorm:"column:unique_id;type:VARCHAR(32);index;"`          // 连接的唯一 ID，可以通过 Proxy 协议头部传给回源地址
+	Nation          sql.NullString `gorm:"column:nation;type:VARCHAR(50);"`
+	Province        sql.NullString `gorm:"column:province;type:VARCHAR(50);"`
+	City            sql.NullString `gorm:"column:city;type:VARCHAR(50);"`
+	ISP             sql.NullString `gorm:"column:isp;type:VARCHAR(50);"`
+	To              string         `gorm:"column:to;type:VARCHAR(50);not null;"`
+	ClientVersion   sql.NullString `gorm:"column:client_version;type:VARCHAR(255);"` // 客户端的SSH标识行（例如 SSH-2.0-OpenSSH_9.6），未读取时为空
+	HASSH           sql.NullString `gorm:"column:hassh;type:VARCHAR(32);index;"`     // 客户端密钥交换（KEXINIT）的 HASSH 指纹
+	HASSHAlgorithms sql.NullString `gorm:"column:hassh_algorithms;type:TEXT;"`       // 计算 HASSH 指纹使用的算法列表
+	Accept          bool           `gorm:"column:accept;not null;"`
+	Time            time.Time      `gorm:"column:time;not null;"`
+	TimeConsuming   sql.NullInt64  `gorm:"column:time_consuming;"`                    // 单位：毫秒（Millisecond）
+	UploadBytes     sql.NullInt64  `gorm:"column:upload_bytes;"`                      // 客户端发送到回源地址的字节数
+	DownloadBytes   sql.NullInt64  `gorm:"column:download_bytes;"`                    // 回源地址发送到客户端的字节数
+	DisconnectCause sql.NullString `gorm:"column:disconnect_cause;type:VARCHAR(20);"` // 连接结束的原因分类（见 Disconnect* 常量），未结束或被拒绝的连接为空
+	Mark            string         `gorm:"column:mark;type:VARCHAR(200);not null;"`
 }
+
+// 连接结束的原因分类
+const (
+	DisconnectClient   = "client"   // 客户端断开
+	DisconnectUpstream = "upstream" // 回源地址断开
+	DisconnectError    = "error"    // 转发出错（例如连接被重置）
+	DisconnectShutdown = "shutdown" // 服务停止
+	DisconnectKilled   = "killed"   // 被管理员断开
+	DisconnectTimeout  = "timeout"  // 空闲超时、达到最长时长等
+	DisconnectPolicy   = "policy"   // 建立转发后被规则断开（例如客户端指纹检查）
+	DisconnectBanned   = "banned"   // 会话建立后来源被封禁
+)
@@ -7,6 +7,7 @@ import (
 	"github.com/mattn/go-isatty"
 	"io"
 	"os"
+	"sync/atomic"
 )
 
 type LoggerLevel string
@@ -50,11 +51,37 @@ type Logger struct {
 	args0Name  string
 }
 
-var globalLogger *Logger = nil
+var globalLogger atomic.Pointer[Logger]
 var DefaultWarnWriter = os.Stdout
 var DefaultErrorWriter = os.Stderr
 
 func InitLogger(warnWriter, errWriter io.Writer) error {
+	logger, err := newLogger(warnWriter, errWriter)
+	if err != nil {
+		return err
+	}
+
+	globalLogger.Store(logger)
+	return nil
+}
+
+// ReloadLogger 按照重载后的配置重新设置日志等级等参数，读取失败时保留原来的设定
+func ReloadLogger() error {
+	old := globalLogger.Load()
+	if old == nil {
+		return fmt.Errorf("logger is not ready")
+	}
+
+	logger, err := newLogger(old.warnWriter, old.errWriter)
+	if err != nil {
+		return err
+	}
+
+	globalLogger.Store(logger)
+	return nil
+}
+
+func newLogger(warnWriter, errWriter io.Writer) (*Logger, error) {
 	if !config.IsReady() {
 		panic("config is not ready")
 	}
@@ -62,7 +89,7 @@ func InitLogger(warnWriter, errWriter io.Writer) error {
 	level := LoggerLevel(config.GetConfig().GlobalConfig.LogLevel)
 	logLevel, ok := levelMap[level]
 	if !ok {
-		return fmt.Errorf("invalid log level: %s", level)
+		return nil, fmt.Errorf("invalid log level: %s", level)
 	}
 
 	if warnWriter == nil {
@@ -83,12 +110,11 @@ func InitLogger(warnWriter, errWriter io.Writer) error {
 		args0Name:  utils.GetArgs0Name(),
 	}
 
-	globalLogger = logger
-	return nil
+	return logger, nil
 }
 
 func IsReady() bool {
-	return globalLogger != nil
+	return globalLogger.Load() != nil
 }
 
 func (l *Logger) Executablef(format string, args ...interface{}) string {
@@ -8,257 +8,257 @@ func Executablef(format string, args ...interface{}) string {
 	if !IsReady() {
 		return ""
 	}
-	return globalLogger.Executablef(format, args...)
+	return globalLogger.Load().Executablef(format, args...)
 }
 
 func Tagf(format string, args ...interface{}) {
 	if !IsReady() {
 		return
 	}
-	globalLogger.TagSkipf(1, format, args...)
+	globalLogger.Load().TagSkipf(1, format, args...)
 }
 
 func Debugf(format string, args ...interface{}) {
 	if !IsReady() {
 		return
 	}
-	globalLogger.Debugf(format, args...)
+	globalLogger.Load().Debugf(format, args...)
 }
 
 func Infof(format string, args ...interface{}) {
 	if !IsReady() {
 		return
 	}
-	globalLogger.Infof(format, args...)
+	globalLogger.Load().Infof(format, args...)
 }
 
 func Warnf(format string, args ...interface{}) {
 	if !IsReady() {
 		return
 	}
-	globalLogger.Warnf(format, args...)
+	globalLogger.Load().Warnf(format, args...)
 }
 
 func Errorf(format string, args ...interface{}) {
 	if !IsReady() {
 		return
 	}
-	globalLogger.Errorf(format, args...)
+	globalLogger.Load().Errorf(format, args...)
 }
 
 func Panicf(format string, args ...interface{}) {
 	if !IsReady() {
 		return
 	}
-	globalLogger.Panicf(format, args...)
+	globalLogger.Load().Panicf(format, args...)
 }
 
 func Tag(args ...interface{}) {
 	if !IsReady() {
 		return
 	}
-	globalLogger.TagSkip(1, args...)
+	globalLogger.Load().TagSkip(1, args...)
 }
 
 func Debug(args ...interface{}) {
 	if !IsReady() {
 		return
 	}
-	globalLogger.Debug(args...)
+	globalLogger.Load().Debug(args...)
 }
 
 func Info(args ...interface{}) {
 	if !IsReady() {
 		return
 	}
-	globalLogger.Info(args...)
+	globalLogger.Load().Info(args...)
 }
 
 func Warn(args ...interface{}) {
 	if !IsReady() {
 		return
 	}
-	globalLogger.Warn(args...)
+	globalLogger.Load().Warn(args...)
 }
 
 func Error(args ...interface{}) {
 	if !IsReady() {
 		return
 	}
-	globalLogger.Error(args...)
+	globalLogger.Load().Error(args...)
 }
 
 func Panic(args ...interface{}) {
 	if !IsReady() {
 		return
 	}
-	globalLogger.Panic(args...)
+	globalLogger.Load().Panic(args...)
 }
 
 func TagWrite(msg string) {
 	if !IsReady() {
 		return
 	}
-	globalLogger.TagSkip(1, msg)
+	globalLogger.Load().TagSkip(1, msg)
 }
 
 func DebugWrite(msg string) {
 	if !IsReady() {
 		return
 	}
-	globalLogger.DebugWrite(msg)
+	globalLogger.Load().DebugWrite(msg)
 }
 
 func InfoWrite(msg string) {
 	if !IsReady() {
 		return
 	}
-	globalLogger.InfoWrite(msg)
+	globalLogger.Load().InfoWrite(msg)
 }
 
 func WarnWrite(msg string) {
 	if !IsReady() {
 		return
 	}
-	globalLogger.WarnWrite(msg)
+	globalLogger.Load().WarnWrite(msg)
 }
 
 func ErrorWrite(msg string) {
 	if !IsReady() {
 		return
 	}
-	globalLogger.ErrorWrite(msg)
+	globalLogger.Load().ErrorWrite(msg)
 }
 
 func PanicWrite(msg string) {
 	if !IsReady() {
 		return
 	}
-	globalLogger.PanicWrite(msg)
+	globalLogger.Load().PanicWrite(msg)
 }
 
 func GetDebugWriter() io.Writer {
 	if !IsReady() {
 		return DefaultWarnWriter
 	}
-	return globalLogger.GetDebugWriter()
+	return globalLogger.Load().GetDebugWriter()
 }
 
 func GetInfoWriter() io.Writer {
 	if !IsReady() {
 		return DefaultWarnWriter
 	}
-	return globalLogger.GetInfoWriter()
+	return globalLogger.Load().GetInfoWriter()
 }
 
 func GetWarningWriter() io.Writer {
 	if !IsReady() {
 		return DefaultWarnWriter
 	}
-	return globalLogger.GetWarningWriter()
+	return globalLogger.Load().GetWarningWriter()
 }
 
 func GetTagWriter() io.Writer {
 	if !IsReady() {
 		return DefaultWarnWriter
 	}
-	return globalLogger.GetTagWriter()
+	return globalLogger.Load().GetTagWriter()
 }
 
 func GetErrorWriter() io.Writer {
 	if !IsReady() {
 		return DefaultWarnWriter
 	}
-	return globalLogger.GetErrorWriter()
+	return globalLogger.Load().GetErrorWriter()
 }
 
 func GetPanicWriter() io.Writer {
 	if !IsReady() {
 		return DefaultWarnWriter
 	}
-	return globalLogger.GetPanicWriter()
+	return globalLogger.Load().GetPanicWriter()
 }
 
 func IsDebugTerm() bool {
 	if !IsReady() {
 		return false
 	}
-	return globalLogger.IsDebugTerm()
+	return globalLogger.Load().IsDebugTerm()
 }
 
 func IsInfoTerm() bool {
 	if !IsReady() {
 		return false
 	}
-	return globalLogger.IsDebugTerm()
+	return globalLogger.Load().IsDebugTerm()
 }
 
 func IsTagTerm() bool {
 	if !IsReady() {
 		return false
 	}
-	return globalLogger.IsTagTerm()
+	return globalLogger.Load().IsTagTerm()
 }
 
 func IsWarnTerm() bool {
 	if !IsReady() {
 		return false
 	}
-	return globalLogger.IsWarnTerm()
+	return globalLogger.Load().IsWarnTerm()
 }
 
 func IsErrorTerm() bool {
 	if !IsReady() {
 		return false
 	}
-	return globalLogger.IsErrorTerm()
+	return globalLogger.Load().IsErrorTerm()
 }
 
 func IsPanicTerm() bool {
 	if !IsReady() {
 		return false
 	}
-	return globalLogger.IsPanicTerm()
+	return globalLogger.Load().IsPanicTerm()
 }
 
 func IsDebugTermNotDumb() bool {
 	if !IsReady() {
 		return false
 	}
-	return globalLogger.IsDebugTerm()
+	return globalLogger.Load().IsDebugTerm()
 }
 
 func IsInfoTermNotDumb() bool {
 	if !IsReady() {
 		return false
 	}
-	return globalLogger.IsInfoTermNotDumb()
+	return globalLogger.Load().IsInfoTermNotDumb()
 }
 
 func IsTagTermNotDumb() bool {
 	if !IsReady() {
 		return false
 	}
-	return globalLogger.IsTagTermNotDumb()
+	return globalLogger.Load().IsTagTermNotDumb()
 }
 
 func IsWarnTermNotDumb() bool {
 	if !IsReady() {
 		return false
 	}
-	return globalLogger.IsWarnTermNotDumb()
+	return globalLogger.Load().IsWarnTermNotDumb()
 }
 
 func IsErrorTermNotDumb() bool {
 	if !IsReady() {
 		return false
 	}
-	return globalLogger.IsErrorTermNotDumb()
+	return globalLogger.Load().IsErrorTermNotDumb()
 }
 
 func IsPanicTermNotDumb() bool {
 	if !IsReady() {
 		return false
 	}
-	return globalLogger.IsPanicTermNotDumb()
+	return globalLogger.Load().IsPanicTermNotDumb()
 }
@@ -0,0 +1,41 @@
+package sshwatcher
+
+import (
+	"fmt"
+	"github.com/SongZihuan/ssh-watcher/src/admin"
+	"github.com/SongZihuan/ssh-watcher/src/config"
+	"github.com/SongZihuan/ssh-watcher/src/logger"
+	"github.com/SongZihuan/ssh-watcher/src/sshserver"
+	"net"
+)
+
+// startAdmin 启动管理接口服务，inherited 为外部传入的管理接口监听（升级或 systemd 套接字激活），未启用时返回 nil
+func startAdmin(ser *sshserver.SshServerGroup, inherited []net.Listener) (*admin.Server, error) {
+	if config.GetConfig().Admin.Address == "" {
+		for _, ln := range inherited {
+			logger.Warnf("admin is disabled, close inherited listener %s", ln.Addr().String())
+			_ = ln.Close()
+		}
+		return nil, nil
+	}
+
+	var ln net.Listener
+	if len(inherited) > 0 {
+		ln = inherited[0]
+		for _, rest := range inherited[1:] {
+			_ = rest.Close()
+		}
+	}
+
+	server, err := admin.NewServer(ser, ln)
+	if err != nil {
+		return nil, fmt.Errorf("init admin server fail: %s", err.Error())
+	}
+
+	err = server.Start()
+	if err != nil {
+		return nil, fmt.Errorf("start admin server fail: %s", err.Error())
+	}
+
+	return server, nil
+}
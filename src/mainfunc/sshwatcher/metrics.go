@@ -0,0 +1,41 @@
+package sshwatcher
+
+import (
+	"fmt"
+	"github.com/SongZihuan/ssh-watcher/src/config"
+	"github.com/SongZihuan/ssh-watcher/src/logger"
+	"github.com/SongZihuan/ssh-watcher/src/metrics"
+	"github.com/SongZihuan/ssh-watcher/src/sshserver"
+	"net"
+)
+
+// startMetrics 启动监控指标服务，inherited 为外部传入的监控指标监听（升级或 systemd 套接字激活），未启用时返回 nil
+func startMetrics(ser *sshserver.SshServerGroup, inherited []net.Listener) (*metrics.Server, error) {
+	if config.GetConfig().Metrics.Address == "" {
+		for _, ln := range inherited {
+			logger.Warnf("metrics is disabled, close inherited listener %s", ln.Addr().String())
+			_ = ln.Close()
+		}
+		return nil, nil
+	}
+
+	var ln net.Listener
+	if len(inherited) > 0 {
+		ln = inherited[0]
+		for _, rest := range inherited[1:] {
+			_ = rest.Close()
+		}
+	}
+
+	server, err := metrics.NewServer(ser, ln)
+	if err != nil {
+		return nil, fmt.Errorf("init metrics server fail: %s", err.Error())
+	}
+
+	err = server.Start()
+	if err != nil {
+		return nil, fmt.Errorf("start metrics server fail: %s", err.Error())
+	}
+
+	return server, nil
+}
@@ -0,0 +1,56 @@
+package sshwatcher
+
+import (
+	"fmt"
+	"github.com/SongZihuan/ssh-watcher/src/config"
+	"github.com/SongZihuan/ssh-watcher/src/logger"
+	"github.com/SongZihuan/ssh-watcher/src/notify"
+	"github.com/SongZihuan/ssh-watcher/src/smtpserver"
+	"github.com/SongZihuan/ssh-watcher/src/sshserver"
+	"github.com/SongZihuan/ssh-watcher/src/systemd"
+	"strings"
+)
+
+// reload 重新读取配置文件，配置有误时继续使用原配置。
+// 日志、通知和规则立即生效；转发的监听端口或回源地址变化时才重启监听，已有的会话不受影响。
+func reload(ser *sshserver.SshServerGroup) {
+	logger.Warnf("reload config: %s", config.GetConfigPathFile())
+
+	cfgErr := config.ReloadConfig()
+	if cfgErr != nil && cfgErr.IsError() {
+		logger.Errorf("reload config fail, keep the old config: %s", cfgErr.Error())
+		notify.SendReload(false, nil, fmt.Sprintf("配置文件有误，继续使用原配置：%s", cfgErr.Error()))
+		sdNotify(systemd.Status("running, reload config fail"))
+		return
+	}
+
+	errs := make([]string, 0, 3)
+
+	err := logger.ReloadLogger()
+	if err != nil {
+		logger.Errorf("reload logger fail: %s", err.Error())
+		errs = append(errs, fmt.Sprintf("日志设定重载失败：%s", err.Error()))
+	}
+
+	err = smtpserver.ReloadSmtp()
+	if err != nil {
+		logger.Errorf("reload smtp fail: %s", err.Error())
+		errs = append(errs, fmt.Sprintf("SMTP设定重载失败：%s", err.Error()))
+	}
+
+	changes, err := ser.Reload(config.GetConfig().SSH.ForwardList)
+	if err != nil {
+		logger.Errorf("reload ssh watcher server fail: %s", err.Error())
+		errs = append(errs, fmt.Sprintf("转发重载失败：%s", err.Error()))
+	}
+
+	if len(errs) > 0 {
+		notify.SendReload(false, changes, strings.Join(errs, "；"))
+		sdNotify(systemd.Status("running, reload config fail"))
+		return
+	}
+
+	logger.Warnf("reload config success: %s", strings.Join(changes, " "))
+	notify.SendReload(true, changes, "")
+	sdNotify(systemd.Status("running"))
+}
@@ -0,0 +1,73 @@
+package sshwatcher
+
+import (
+	"fmt"
+	"github.com/SongZihuan/ssh-watcher/src/config"
+	"github.com/SongZihuan/ssh-watcher/src/logger"
+	"github.com/SongZihuan/ssh-watcher/src/sshserver"
+	"github.com/SongZihuan/ssh-watcher/src/systemd"
+	"github.com/SongZihuan/ssh-watcher/src/upgrade"
+	"net"
+)
+
+// inheritedListeners 读取升级时旧进程传入的监听，或者 systemd 套接字激活传入的监听，都没有时返回 nil
+func inheritedListeners() (map[string][]net.Listener, error) {
+	listeners, err := upgrade.Listeners()
+	if err != nil {
+		return nil, fmt.Errorf("read upgrade listeners fail: %s", err.Error())
+	}
+
+	if upgrade.ParentPID() == 0 {
+		if !config.GetConfig().Systemd.SocketActivation.IsEnable(true) {
+			systemd.CloseListenFds()
+			return nil, nil
+		}
+
+		listeners, err = systemd.Listeners()
+		if err != nil {
+			return nil, fmt.Errorf("read systemd socket activation listeners fail: %s", err.Error())
+		}
+	}
+
+	for name, lns := range listeners {
+		for _, ln := range lns {
+			logger.Infof("inherited listener %s: %s", name, ln.Addr().String())
+		}
+	}
+
+	return listeners, nil
+}
+
+// sdNotify 向 systemd 报告状态，未启用时不做任何事
+func sdNotify(states ...string) {
+	if !config.GetConfig().Systemd.Notify.IsEnable(true) {
+		return
+	}
+
+	err := systemd.Notify(states...)
+	if err != nil {
+		logger.Errorf("systemd notify fail: %s", err.Error())
+	}
+}
+
+// startWatchdog 启动 systemd 看门狗，未启用时返回 nil
+func startWatchdog(ser *sshserver.SshServerGroup) (*systemd.Watchdog, error) {
+	if !config.GetConfig().Systemd.Notify.IsEnable(true) {
+		return nil, nil
+	}
+
+	watchdog := systemd.NewWatchdog(func() error {
+		return ser.Healthy(config.GetConfig().Systemd.WatchdogAcceptTimeoutDuration)
+	})
+	if watchdog == nil {
+		return nil, nil
+	}
+
+	err := watchdog.Start()
+	if err != nil {
+		return nil, fmt.Errorf("start systemd watchdog fail: %s", err.Error())
+	}
+
+	logger.Infof("systemd watchdog interval: %s", watchdog.Interval())
+	return watchdog, nil
+}
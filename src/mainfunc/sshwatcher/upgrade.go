@@ -0,0 +1,48 @@
+package sshwatcher
+
+import (
+	"github.com/SongZihuan/ssh-watcher/src/admin"
+	"github.com/SongZihuan/ssh-watcher/src/config"
+	"github.com/SongZihuan/ssh-watcher/src/logger"
+	"github.com/SongZihuan/ssh-watcher/src/metrics"
+	"github.com/SongZihuan/ssh-watcher/src/notify"
+	"github.com/SongZihuan/ssh-watcher/src/sshserver"
+	"github.com/SongZihuan/ssh-watcher/src/systemd"
+	"github.com/SongZihuan/ssh-watcher/src/upgrade"
+	"net"
+)
+
+// upgradeProcess 启动新的可执行文件并传递所有监听，等待新进程启动完成。
+// 成功时返回新进程的 PID，旧进程随后停止接受连接并等待会话结束；失败时旧进程继续运行。
+// metricsServer 和 adminServer 为 nil 时表示未启用监控指标和管理接口。
+func upgradeProcess(ser *sshserver.SshServerGroup, metricsServer *metrics.Server, adminServer *admin.Server) (newPID int, ok bool) {
+	logger.Warnf("upgrade: start new process")
+
+	listeners := ser.Listeners()
+	if metricsServer != nil {
+		listeners[metrics.ListenerName] = []net.Listener{metricsServer.Listener()}
+	}
+	if adminServer != nil {
+		listeners[admin.ListenerName] = []net.Listener{adminServer.Listener()}
+	}
+
+	child, err := upgrade.Exec(listeners)
+	if err != nil {
+		logger.Errorf("upgrade fail: %s", err.Error())
+		notify.SendUpgrade(false, 0, err.Error())
+		return 0, false
+	}
+
+	err = child.WaitReady(config.GetConfig().Upgrade.ReadyTimeoutDuration)
+	if err != nil {
+		logger.Errorf("upgrade fail: %s", err.Error())
+		notify.SendUpgrade(false, child.PID(), err.Error())
+		return 0, false
+	}
+
+	logger.Warnf("upgrade: new process %d is ready, stop accepting and wait for sessions", child.PID())
+	sdNotify(systemd.MainPID(child.PID()))
+	notify.SendUpgrade(true, child.PID(), "")
+
+	return child.PID(), true
+}
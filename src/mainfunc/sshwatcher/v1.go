@@ -1,25 +1,33 @@
 package sshwatcher
 
 import (
+	"context"
 	"errors"
 	"fmt"
+	"github.com/SongZihuan/ssh-watcher/src/admin"
 	"github.com/SongZihuan/ssh-watcher/src/config"
+	"github.com/SongZihuan/ssh-watcher/src/configwatcher"
 	"github.com/SongZihuan/ssh-watcher/src/database"
 	"github.com/SongZihuan/ssh-watcher/src/flagparser"
 	"github.com/SongZihuan/ssh-watcher/src/ipcheck"
 	"github.com/SongZihuan/ssh-watcher/src/logger"
+	"github.com/SongZihuan/ssh-watcher/src/metrics"
 	"github.com/SongZihuan/ssh-watcher/src/notify"
 	"github.com/SongZihuan/ssh-watcher/src/redisserver"
 	"github.com/SongZihuan/ssh-watcher/src/smtpserver"
 	"github.com/SongZihuan/ssh-watcher/src/sshserver"
+	"github.com/SongZihuan/ssh-watcher/src/systemd"
+	"github.com/SongZihuan/ssh-watcher/src/upgrade"
 	"github.com/SongZihuan/ssh-watcher/src/utils"
 	"os"
 	"sync"
+	"syscall"
 	"time"
 )
 
 func MainV1() (exitcode int) {
 	var err error
+	var upgraded = false // 已升级，旧进程正在等待会话结束
 
 	if ipcheck.SupportIPv4() {
 		fmt.Println("Server support ipv4.")
@@ -40,7 +48,11 @@ func MainV1() (exitcode int) {
 
 	defer func() {
 		// 此处使用同步通知
-		notify.SyncSendStop(exitcode)
+		if upgraded {
+			notify.SyncSendUpgradeStop(exitcode)
+		} else {
+			notify.SyncSendStop(exitcode)
+		}
 	}()
 
 	err = flagparser.InitFlag()
@@ -116,7 +128,19 @@ func MainV1() (exitcode int) {
 	}
 	defer redisserver.CloseRedis()
 
-	ser, err := sshserver.NewSshServer(&config.GetConfig().SSH.Forward)
+	inherited, err := inheritedListeners()
+	if err != nil {
+		logger.Errorf("%s\n", err.Error())
+		return 1
+	}
+
+	metricsInherited := inherited[metrics.ListenerName]
+	delete(inherited, metrics.ListenerName)
+
+	adminInherited := inherited[admin.ListenerName]
+	delete(inherited, admin.ListenerName)
+
+	ser, err := sshserver.NewSshServerGroup(config.GetConfig().SSH.ForwardList, inherited)
 	if err != nil {
 		logger.Errorf("init ssh watcher server fail: %s\n", err.Error())
 		return 1
@@ -134,11 +158,95 @@ func MainV1() (exitcode int) {
 		_ = ser.Stop()
 	}()
 
-	notify.SendStart() // 此处是Start不是WaitStart
+	if config.GetConfig().Reload.Watch.IsEnable(false) {
+		watcher, err := configwatcher.NewWatcher()
+		if err != nil {
+			logger.Errorf("init config watcher fail: %s", err.Error())
+			return 1
+		}
+
+		err = watcher.Start()
+		if err != nil {
+			logger.Errorf("start config watcher fail: %s", err.Error())
+			return 1
+		}
+		defer func() {
+			_ = watcher.Stop()
+		}()
+	}
+
+	metricsServer, err := startMetrics(ser, metricsInherited)
+	if err != nil {
+		logger.Errorf("%s", err.Error())
+		return 1
+	} else if metricsServer != nil {
+		defer func() {
+			_ = metricsServer.Stop()
+		}()
+	}
+
+	adminServer, err := startAdmin(ser, adminInherited)
+	if err != nil {
+		logger.Errorf("%s", err.Error())
+		return 1
+	} else if adminServer != nil {
+		defer func() {
+			_ = adminServer.Stop()
+		}()
+	}
+
+	err = upgrade.Ready()
+	if err != nil {
+		logger.Errorf("notify old process fail: %s\n", err.Error())
+		return 1
+	}
+
+	sdNotify(systemd.StateReady, systemd.Status("running"))
 
-	select {
-	case <-config.GetSignalChan():
-		notify.SendWaitStop("接收到退出信号")
+	watchdog, err := startWatchdog(ser)
+	if err != nil {
+		logger.Errorf("%s", err.Error())
+		return 1
+	} else if watchdog != nil {
+		defer func() {
+			_ = watchdog.Stop()
+		}()
+	}
+	if upgrade.ParentPID() != 0 {
+		notify.SendUpgradeStart(upgrade.ParentPID())
+	} else {
+		notify.SendStart() // 此处是Start不是WaitStart
+	}
+
+	for {
+		sig := <-config.GetSignalChan()
+		if sig == syscall.SIGHUP {
+			reload(ser)
+			continue
+		}
+
+		drain := time.Duration(0) // 使用各转发的设定
+		if config.SignalUpgrade != nil && sig == config.SignalUpgrade {
+			_, ok := upgradeProcess(ser, metricsServer, adminServer)
+			if !ok {
+				continue
+			}
+
+			upgraded = true // 新进程已接管监听，不再报告 STOPPING
+			if metricsServer != nil {
+				_ = metricsServer.Stop() // 监控指标由新进程提供
+			}
+			if adminServer != nil {
+				_ = adminServer.Stop() // 管理接口由新进程提供，旧进程的会话不能再通过管理接口断开
+			}
+			drain = config.GetConfig().Upgrade.DrainTimeoutDuration
+		} else {
+			sdNotify(systemd.StateStopping, systemd.Status("stopping"))
+			notify.SendWaitStop("接收到退出信号")
+		}
+
+		forcectx, force := context.WithCancel(context.Background())
+		defer force()
 
 		var wg sync.WaitGroup
 		wg.Add(2)
@@ -146,7 +254,7 @@ func MainV1() (exitcode int) {
 		go func() {
 			defer wg.Done()
 
-			_ = ser.Stop() // 提前关闭，同时代码上面的 defer 兜底
+			_ = ser.StopContext(forcectx, drain) // 提前关闭，同时代码上面的 defer 兜底
 		}()
 
 		go func() {
@@ -155,7 +263,27 @@ func MainV1() (exitcode int) {
 			_ = cleaner.Stop() // 提前关闭，同时代码上面的 defer 兜底
 		}()
 
-		wg.Wait()
+		var donechan = make(chan bool)
+		go func() {
+			defer close(donechan)
+			wg.Wait()
+		}()
+
+	WaitCycle:
+		for { // 等待会话结束期间（升级后可能长达数小时）继续处理信号，再次收到退出信号时强制断开剩余的会话
+			select {
+			case <-donechan:
+				break WaitCycle
+			case sig := <-config.GetSignalChan():
+				if sig == syscall.SIGHUP || (config.SignalUpgrade != nil && sig == config.SignalUpgrade) {
+					logger.Warnf("ignore signal %s while waiting for sessions to end", sig.String())
+					continue
+				}
+
+				logger.Warnf("receive signal %s again, close all remaining sessions", sig.String())
+				force()
+			}
+		}
 
 		time.Sleep(1 * time.Second)
 		return 0
@@ -0,0 +1,66 @@
+package metrics
+
+import (
+	"fmt"
+	"github.com/SongZihuan/ssh-watcher/src/sshserver"
+	"io"
+	"strconv"
+	"strings"
+)
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func forwardLabel(name string) string {
+	return fmt.Sprintf(`forward="%s"`, labelEscaper.Replace(name))
+}
+
+func writeHeader(w io.Writer, name string, typ string, help string) {
+	_, _ = fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, typ)
+}
+
+// writeAcceptMetrics 输出新连接检查的监控指标，同一指标的所有转发写在一起
+func writeAcceptMetrics(w io.Writer, list []sshserver.AcceptMetrics) {
+	series := []struct {
+		name  string
+		typ   string
+		help  string
+		value func(m *sshserver.AcceptMetrics) int64
+	}{
+		{"hsw_accept_queue_depth", "gauge", "Accepted connections waiting for a worker.", func(m *sshserver.AcceptMetrics) int64 { return int64(m.QueueDepth) }},
+		{"hsw_accept_queue_capacity", "gauge", "Maximum number of accepted connections waiting for a worker.", func(m *sshserver.AcceptMetrics) int64 { return int64(m.QueueCapacity) }},
+		{"hsw_accept_workers", "gauge", "Number of workers checking new connections.", func(m *sshserver.AcceptMetrics) int64 { return int64(m.Workers) }},
+		{"hsw_accept_workers_busy", "gauge", "Workers currently checking a connection.", func(m *sshserver.AcceptMetrics) int64 { return int64(m.WorkersBusy) }},
+		{"hsw_accept_queue_full_total", "counter", "Connections closed because the accept queue was full.", func(m *sshserver.AcceptMetrics) int64 { return m.QueueFull }},
+		{"hsw_accept_decision_timeout_total", "counter", "Connections rejected because the decision deadline was exceeded.", func(m *sshserver.AcceptMetrics) int64 { return m.DecisionTimeouts }},
+	}
+
+	for _, g := range series {
+		writeHeader(w, g.name, g.typ, g.help)
+		for i := range list {
+			_, _ = fmt.Fprintf(w, "%s{%s} %d\n", g.name, forwardLabel(list[i].Forward), g.value(&list[i]))
+		}
+	}
+
+	writeHeader(w, "hsw_rate_limit_dropped_total", "counter", "Connections dropped by the connection rate limit before any lookup.")
+	for i := range list {
+		for _, scope := range sshserver.RateScopes {
+			_, _ = fmt.Fprintf(w, "hsw_rate_limit_dropped_total{%s,scope=\"%s\"} %d\n", forwardLabel(list[i].Forward), scope, list[i].RateLimited[scope])
+		}
+	}
+
+	const histogram = "hsw_accept_decision_seconds"
+	writeHeader(w, histogram, "histogram", "Time from accepting a connection to forwarding or rejecting it, including the time in queue.")
+	for i := range list {
+		m := &list[i]
+		label := forwardLabel(m.Forward)
+
+		for j, bound := range sshserver.DecisionBuckets {
+			le := strconv.FormatFloat(bound.Seconds(), 'g', -1, 64)
+			_, _ = fmt.Fprintf(w, "%s_bucket{%s,le=\"%s\"} %d\n", histogram, label, le, m.DecisionBuckets[j])
+		}
+
+		_, _ = fmt.Fprintf(w, "%s_bucket{%s,le=\"+Inf\"} %d\n", histogram, label, m.DecisionCount)
+		_, _ = fmt.Fprintf(w, "%s_sum{%s} %s\n", histogram, label, strconv.FormatFloat(m.DecisionSum.Seconds(), 'g', -1, 64))
+		_, _ = fmt.Fprintf(w, "%s_count{%s} %d\n", histogram, label, m.DecisionCount)
+	}
+}
@@ -0,0 +1,118 @@
+package metrics
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/SongZihuan/ssh-watcher/src/config"
+	"github.com/SongZihuan/ssh-watcher/src/logger"
+	"github.com/SongZihuan/ssh-watcher/src/sshserver"
+	"net"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	StatusReady int32 = iota
+	StatusRunning
+	StatusStopping
+	StatusFinished
+)
+
+// ListenerName 升级时传递给新进程的监控指标监听的名称（转发名称不允许以 @ 开头）
+const ListenerName = "@metrics"
+
+// Source 提供监控指标的数据
+type Source interface {
+	AcceptMetrics() []sshserver.AcceptMetrics
+}
+
+// Server 以 Prometheus 文本格式提供监控指标的 HTTP 服务
+type Server struct {
+	status atomic.Int32
+	ln     net.Listener
+	server *http.Server
+	swg    sync.WaitGroup
+}
+
+// NewServer 创建监控指标服务，inherited 为升级时旧进程传入的监听，可以为 nil
+func NewServer(source Source, inherited net.Listener) (*Server, error) {
+	if !config.IsReady() {
+		panic("config is not ready")
+	}
+
+	cfg := config.GetConfig().Metrics
+
+	ln := inherited
+	if ln == nil {
+		var err error
+		ln, err = net.Listen("tcp", cfg.Address)
+		if err != nil {
+			return nil, fmt.Errorf("metrics listen on %s failed: %s", cfg.Address, err.Error())
+		}
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc(cfg.Path, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		writeAcceptMetrics(w, source.AcceptMetrics())
+	})
+
+	res := &Server{
+		ln: ln,
+		server: &http.Server{
+			Handler:           mux,
+			ReadHeaderTimeout: 5 * time.Second,
+		},
+	}
+
+	res.status.Store(StatusReady)
+
+	return res, nil
+}
+
+func (s *Server) Start() error {
+	if s.status.Load() != StatusReady {
+		return nil
+	}
+
+	s.swg.Add(1)
+	go func() {
+		defer s.swg.Done()
+
+		logger.Infof("metrics listen on %s start", s.ln.Addr().String())
+		err := s.server.Serve(s.ln)
+		if err != nil && !errors.Is(err, http.ErrServerClosed) {
+			logger.Errorf("metrics server error: %s", err.Error())
+		}
+		logger.Infof("metrics listen on %s stop", s.ln.Addr().String())
+	}()
+
+	if !s.status.CompareAndSwap(StatusReady, StatusRunning) {
+		return fmt.Errorf("status error")
+	}
+
+	return nil
+}
+
+// Listener 正在使用的监听，用于升级时传给新进程
+func (s *Server) Listener() net.Listener {
+	return s.ln
+}
+
+func (s *Server) Stop() error {
+	if !s.status.CompareAndSwap(StatusRunning, StatusStopping) {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	_ = s.server.Shutdown(ctx)
+	s.swg.Wait()
+
+	s.status.CompareAndSwap(StatusStopping, StatusFinished)
+	return nil
+}
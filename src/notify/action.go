@@ -5,8 +5,10 @@ import (
 	"github.com/SongZihuan/ssh-watcher/src/config"
 	"github.com/SongZihuan/ssh-watcher/src/smtpserver"
 	"github.com/SongZihuan/ssh-watcher/src/wxrobot"
+	"os"
 	"runtime"
 	"sync"
+	"time"
 )
 
 var hasSendStart = false
@@ -81,24 +83,128 @@ func SyncSendStop(exitcode int) {
 	wg.Wait()
 }
 
-func SendSshBanned(ip string, loc *apiip.QueryIpLocationData, to string, reason string) {
+func SendSshBanned(forward string, ip string, loc *apiip.QueryIpLocationData, to string, reason string) {
 	if !config.IsReady() {
 		panic("config is not ready")
 	} else if config.GetConfig().Quite.IsEnable(false) {
 		return
 	}
 
-	go wxrobot.SendSshBanned(ip, loc, to, reason)
-	go smtpserver.SendSshBanned(ip, loc, to, reason)
+	go wxrobot.SendSshBanned(forward, ip, loc, to, reason)
+	go smtpserver.SendSshBanned(forward, ip, loc, to, reason)
 }
 
-func SendSshSuccess(ip string, loc *apiip.QueryIpLocationData, to string, mark string) {
+func SendSshSuccess(forward string, ip string, loc *apiip.QueryIpLocationData, to string, mark string) {
 	if !config.IsReady() {
 		panic("config is not ready")
 	} else if config.GetConfig().Quite.IsEnable(false) {
 		return
 	}
 
-	go wxrobot.SendSshSuccess(ip, loc, to, mark)
-	go smtpserver.SendSshSuccess(ip, loc, to, mark)
+	go wxrobot.SendSshSuccess(forward, ip, loc, to, mark)
+	go smtpserver.SendSshSuccess(forward, ip, loc, to, mark)
+}
+
+func SendSshBackendStatus(forward string, address string, healthy bool, reason string) {
+	if !config.IsReady() {
+		panic("config is not ready")
+	} else if config.GetConfig().Quite.IsEnable(false) {
+		return
+	}
+
+	go wxrobot.SendSshBackendStatus(forward, address, healthy, reason)
+	go smtpserver.SendSshBackendStatus(forward, address, healthy, reason)
+}
+
+func SendSshDisconnect(forward string, ip string, loc *apiip.QueryIpLocationData, to string, mark string, timeConsuming int64, upload int64, download int64) {
+	if !config.IsReady() {
+		panic("config is not ready")
+	} else if config.GetConfig().Quite.IsEnable(false) {
+		return
+	}
+
+	d := time.Duration(timeConsuming) * time.Millisecond
+
+	go wxrobot.SendSshDisconnect(forward, ip, loc, to, mark, d, upload, download)
+	go smtpserver.SendSshDisconnect(forward, ip, loc, to, mark, d, upload, download)
+}
+
+// SendSshDrain 转发停止时仍有活跃会话，sessions 为每个会话的描述（IP、定位和已持续的时长）
+func SendSshDrain(forward string, drain time.Duration, sessions []string) {
+	if !config.IsReady() {
+		panic("config is not ready")
+	} else if config.GetConfig().Quite.IsEnable(false) {
+		return
+	}
+
+	go wxrobot.SendSshDrain(forward, drain, sessions)
+	go smtpserver.SendSshDrain(forward, drain, sessions)
+}
+
+// SendReload 重载配置的结果，changes 为每个转发的变化情况，reason 为失败（或部分失败）的原因
+func SendReload(ok bool, changes []string, reason string) {
+	if !config.IsReady() {
+		panic("config is not ready")
+	} else if config.GetConfig().Quite.IsEnable(false) {
+		return
+	}
+
+	go wxrobot.SendReload(ok, changes, reason)
+	go smtpserver.SendReload(ok, changes, reason)
+}
+
+// SendUpgradeStart 由升级启动的新进程启动完成，用于代替 SendStart
+func SendUpgradeStart(oldPID int) {
+	if !config.IsReady() {
+		panic("config is not ready")
+	} else if config.GetConfig().Quite.IsEnable(false) {
+		return
+	}
+
+	go wxrobot.SendUpgradeStart(oldPID, os.Getpid())
+	go smtpserver.SendUpgradeStart(oldPID, os.Getpid())
+
+	hasSendStart = true
+}
+
+// SendUpgrade 升级的结果，成功时旧进程随后停止接受连接并等待会话结束，用于代替 SendWaitStop；失败时继续使用旧进程
+func SendUpgrade(ok bool, newPID int, reason string) {
+	if !config.IsReady() {
+		panic("config is not ready")
+	} else if config.GetConfig().Quite.IsEnable(false) {
+		return
+	}
+
+	go wxrobot.SendUpgrade(ok, os.Getpid(), newPID, reason)
+	go smtpserver.SendUpgrade(ok, os.Getpid(), newPID, reason)
+}
+
+// SyncSendUpgradeStop 升级后旧进程退出，用于代替 SyncSendStop
+func SyncSendUpgradeStop(exitcode int) {
+	if !config.IsReady() {
+		panic("config is not ready")
+	} else if config.GetConfig().Quite.IsEnable(false) {
+		return
+	}
+
+	if !hasSendStart {
+		return
+	}
+
+	var wg sync.WaitGroup
+	wg.Add(2)
+
+	numGoroutine := runtime.NumGoroutine()
+
+	go func() {
+		defer wg.Done()
+		wxrobot.SendUpgradeStop(os.Getpid(), exitcode, numGoroutine)
+	}()
+
+	go func() {
+		defer wg.Done()
+		smtpserver.SendUpgradeStop(os.Getpid(), exitcode, numGoroutine)
+	}()
+
+	wg.Wait()
 }
@@ -9,20 +9,49 @@ import (
 
 const BannedData = "banned"
 
-func SetSSHIpBanned(ip string, ttl time.Duration) error {
-	key := fmt.Sprintf("ssh:ip:banned:%s", ip)
+// SetSSHIpBanned action 表示封禁期间对连接的处理方式（例如 tarpit），为空表示直接断开
+func SetSSHIpBanned(ip string, ttl time.Duration, action string) error {
+	data := BannedData
+	if action != "" {
+		data = action
+	}
+
+	return setBanned(fmt.Sprintf("ssh:ip:banned:%s", ip), ttl, data)
+}
+
+func QuerySSHIpBanned(ip string) bool { // 返回 true 表示放行
+	return queryBanned(fmt.Sprintf("ssh:ip:banned:%s", ip))
+}
+
+func QuerySSHIpBannedAction(ip string) string { // 返回封禁时设置的 action，未设置时返回 BannedData
+	res, err := rdb.Get(context.Background(), fmt.Sprintf("ssh:ip:banned:%s", ip)).Result()
+	if err != nil {
+		return BannedData
+	}
 
+	return res
+}
+
+func SetSSHHASSHBanned(hassh string, ttl time.Duration) error {
+	return setBanned(fmt.Sprintf("ssh:hassh:banned:%s", hassh), ttl, BannedData)
+}
+
+func QuerySSHHASSHBanned(hassh string) bool { // 返回 true 表示放行
+	return queryBanned(fmt.Sprintf("ssh:hassh:banned:%s", hassh))
+}
+
+func setBanned(key string, ttl time.Duration, data string) error {
 	res1, err := rdb.TTL(context.Background(), key).Result()
 	if err != nil {
 		return err
-	} else if res1 == -1 { // ip被设置封禁且没有TTL
-		logger.Warnf("ip: %s is banned by redis forver", ip)
+	} else if res1 == -1 { // 被设置封禁且没有TTL
+		logger.Warnf("%s is banned by redis forver", key)
 		return nil
 	} else if res1 > ttl { // 原封禁时长更长，则不做变化
 		return nil
 	}
 
-	_, err = rdb.Set(context.Background(), key, BannedData, ttl).Result()
+	_, err = rdb.Set(context.Background(), key, data, ttl).Result()
 	if err != nil {
 		return err
 	}
@@ -30,15 +59,13 @@ func SetSSHIpBanned(ip string, ttl time.Duration) error {
 	return nil
 }
 
-func QuerySSHIpBanned(ip string) bool { // 返回 true 表示放行
-	key := fmt.Sprintf("ssh:ip:banned:%s", ip)
-
+func queryBanned(key string) bool { // 返回 true 表示放行
 	res1, err := rdb.TTL(context.Background(), key).Result()
 	if err != nil {
-		logger.Warnf("query ssh ip (%s) banned from redis error: %s", ip, err.Error())
+		logger.Warnf("query %s from redis error: %s", key, err.Error())
 		return false
-	} else if res1 == -1 { // ip被设置封禁且没有TTL
-		logger.Warnf("ip: %s is banned by redis forver", ip)
+	} else if res1 == -1 { // 被设置封禁且没有TTL
+		logger.Warnf("%s is banned by redis forver", key)
 		return false
 	} else if res1 == -2 { // 键不存在
 		return true
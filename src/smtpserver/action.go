@@ -4,7 +4,9 @@ import (
 	"fmt"
 	"github.com/SongZihuan/ssh-watcher/src/api/apiip"
 	"github.com/SongZihuan/ssh-watcher/src/logger"
+	"github.com/SongZihuan/ssh-watcher/src/utils"
 	"strings"
+	"time"
 )
 
 func logError(err error) {
@@ -33,7 +35,7 @@ func SendStop(exitcode int, numGoroutine int) {
 	logError(Send("服务停止", fmt.Sprintf("服务停止。退出代码：%d。剩余协程数：%d。", exitcode, numGoroutine)))
 }
 
-func SendSshBanned(ip string, loc *apiip.QueryIpLocationData, to string, reason string) {
+func SendSshBanned(forward string, ip string, loc *apiip.QueryIpLocationData, to string, reason string) {
 	if reason == "" {
 		reason = "无。"
 	} else if !strings.HasSuffix(reason, "。") {
@@ -41,13 +43,13 @@ func SendSshBanned(ip string, loc *apiip.QueryIpLocationData, to string, reason
 	}
 
 	if loc == nil {
-		logError(Send("SSH异常请求（拒绝）", fmt.Sprintf("IP %s （无定位信息） 连接到 %s 被拒。原因：%s", ip, to, reason)))
+		logError(Send("SSH异常请求（拒绝）", fmt.Sprintf("IP %s （无定位信息） 通过转发 %s 连接到 %s 被拒。原因：%s", ip, forward, to, reason)))
 	} else {
-		logError(Send("SSH异常请求（拒绝）", fmt.Sprintf("IP %s （%s） 连接到 %s 被拒。原因：%s", ip, loc.String(), to, reason)))
+		logError(Send("SSH异常请求（拒绝）", fmt.Sprintf("IP %s （%s） 通过转发 %s 连接到 %s 被拒。原因：%s", ip, loc.String(), forward, to, reason)))
 	}
 }
 
-func SendSshSuccess(ip string, loc *apiip.QueryIpLocationData, to string, mark string) {
+func SendSshSuccess(forward string, ip string, loc *apiip.QueryIpLocationData, to string, mark string) {
 	if mark == "" {
 		mark = "无。"
 	} else if !strings.HasSuffix(mark, "。") {
@@ -55,8 +57,76 @@ func SendSshSuccess(ip string, loc *apiip.QueryIpLocationData, to string, mark s
 	}
 
 	if loc == nil {
-		logError(Send("SSH请求（通过）", fmt.Sprintf("IP %s （无定位信息） 连接到 %s 成功。备注：%s", ip, to, mark)))
+		logError(Send("SSH请求（通过）", fmt.Sprintf("IP %s （无定位信息） 通过转发 %s 连接到 %s 成功。备注：%s", ip, forward, to, mark)))
 	} else {
-		logError(Send("SSH请求（通过）", fmt.Sprintf("IP %s （%s） 连接到 %s 成功。备注：%s", ip, loc.String(), to, mark)))
+		logError(Send("SSH请求（通过）", fmt.Sprintf("IP %s （%s） 通过转发 %s 连接到 %s 成功。备注：%s", ip, loc.String(), forward, to, mark)))
 	}
 }
+
+func SendSshBackendStatus(forward string, address string, healthy bool, reason string) {
+	if reason == "" {
+		reason = "无。"
+	} else if !strings.HasSuffix(reason, "。") {
+		reason += "。"
+	}
+
+	if healthy {
+		logError(Send("SSH回源地址恢复", fmt.Sprintf("转发 %s 的回源地址 %s 恢复可用。原因：%s", forward, address, reason)))
+	} else {
+		logError(Send("SSH回源地址异常", fmt.Sprintf("转发 %s 的回源地址 %s 不可用。原因：%s", forward, address, reason)))
+	}
+}
+
+func SendSshDisconnect(forward string, ip string, loc *apiip.QueryIpLocationData, to string, mark string, timeConsuming time.Duration, upload int64, download int64) {
+	if mark == "" {
+		mark = "无。"
+	} else if !strings.HasSuffix(mark, "。") {
+		mark += "。"
+	}
+
+	if loc == nil {
+		logError(Send("SSH会话结束", fmt.Sprintf("IP %s （无定位信息） 通过转发 %s 连接到 %s 的会话结束。时长：%s，上传：%s，下载：%s。备注：%s", ip, forward, to, timeConsuming.String(), utils.FormatBytes(upload), utils.FormatBytes(download), mark)))
+	} else {
+		logError(Send("SSH会话结束", fmt.Sprintf("IP %s （%s） 通过转发 %s 连接到 %s 的会话结束。时长：%s，上传：%s，下载：%s。备注：%s", ip, loc.String(), forward, to, timeConsuming.String(), utils.FormatBytes(upload), utils.FormatBytes(download), mark)))
+	}
+}
+
+func SendSshDrain(forward string, drain time.Duration, sessions []string) {
+	logError(Send("SSH转发停止", fmt.Sprintf("转发 %s 停止，已关闭监听，等待 %d 个会话结束（最长 %s，超时后强制断开）：\n%s", forward, len(sessions), drain.String(), strings.Join(sessions, "\n"))))
+}
+
+func SendReload(ok bool, changes []string, reason string) {
+	if reason == "" {
+		reason = "无。"
+	} else if !strings.HasSuffix(reason, "。") {
+		reason += "。"
+	}
+
+	if ok {
+		logError(Send("配置重载完成", fmt.Sprintf("配置重载完成，已有的会话不受影响：\n%s", strings.Join(changes, "\n"))))
+	} else {
+		logError(Send("配置重载失败", fmt.Sprintf("配置重载失败。原因：%s\n%s", reason, strings.Join(changes, "\n"))))
+	}
+}
+
+func SendUpgradeStart(oldPID int, newPID int) {
+	logError(Send("服务升级完成", fmt.Sprintf("服务升级完成，新进程（PID %d）已接管旧进程（PID %d）的监听，服务未中断。", newPID, oldPID)))
+}
+
+func SendUpgrade(ok bool, oldPID int, newPID int, reason string) {
+	if reason == "" {
+		reason = "无。"
+	} else if !strings.HasSuffix(reason, "。") {
+		reason += "。"
+	}
+
+	if ok {
+		logError(Send("服务升级", fmt.Sprintf("服务升级：新进程（PID %d）已启动，旧进程（PID %d）停止接受新连接，等待已有的会话结束后退出。", newPID, oldPID)))
+	} else {
+		logError(Send("服务升级失败", fmt.Sprintf("服务升级失败，继续使用当前进程（PID %d）。原因：%s", oldPID, reason)))
+	}
+}
+
+func SendUpgradeStop(oldPID int, exitcode int, numGoroutine int) {
+	logError(Send("服务升级：旧进程退出", fmt.Sprintf("服务升级：旧进程（PID %d）退出。退出代码：%d。剩余协程数：%d。", oldPID, exitcode, numGoroutine)))
+}
@@ -13,68 +13,91 @@ import (
 	"os"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
-var smtpAddress string = ""
-var smtpUser string = ""
-var smtpPassword string = ""
-var smtpRecipient []*mail.Address
+type smtpSetting struct {
+	address   string
+	user      string
+	password  string
+	recipient []*mail.Address
+}
+
+var setting atomic.Pointer[smtpSetting]
 
 var once sync.Once
 
 func InitSmtp() (err error) {
 	once.Do(func() {
-		recipientList := config.GetConfig().SMTP.Recipient
-
-		smtpAddress = config.GetConfig().SMTP.Address
-		smtpUser = config.GetConfig().SMTP.User
-		smtpPassword = config.GetConfig().SMTP.Password
-		smtpRecipient = make([]*mail.Address, 0, len(recipientList))
-
-		if !config.IsReady() {
-			panic("config is not ready")
-		} else if smtpAddress == "" || smtpUser == "" {
-			return
-		} else if len(recipientList) == 0 {
-			err = fmt.Errorf("not smt recopient")
-			return
-		}
+		err = loadSmtp()
+	})
+	return err
+}
 
-		for _, rec := range recipientList {
-			addr, err := mail.ParseAddress(strings.TrimSpace(rec))
-			if err != nil {
-				fmt.Printf("%s parser failled, ignore\n", rec)
-				continue
-			}
+// ReloadSmtp 重新读取配置中的 SMTP 设定，读取失败时保留原来的设定
+func ReloadSmtp() error {
+	return loadSmtp()
+}
 
-			if !utils.IsValidEmail(addr.Address) {
-				fmt.Printf("%s is not a valid email, ignore\n", addr.Address)
-				continue
-			}
+func loadSmtp() error {
+	if !config.IsReady() {
+		panic("config is not ready")
+	}
+
+	recipientList := config.GetConfig().SMTP.Recipient
+
+	res := &smtpSetting{
+		address:   config.GetConfig().SMTP.Address,
+		user:      config.GetConfig().SMTP.User,
+		password:  config.GetConfig().SMTP.Password,
+		recipient: make([]*mail.Address, 0, len(recipientList)),
+	}
+
+	if res.address == "" || res.user == "" {
+		setting.Store(res)
+		return nil
+	} else if len(recipientList) == 0 {
+		return fmt.Errorf("not smt recopient")
+	}
 
-			smtpRecipient = append(smtpRecipient, addr)
+	for _, rec := range recipientList {
+		addr, err := mail.ParseAddress(strings.TrimSpace(rec))
+		if err != nil {
+			fmt.Printf("%s parser failled, ignore\n", rec)
+			continue
 		}
 
-		if len(smtpRecipient) == 0 {
-			err = fmt.Errorf("not any valid email address to be self recipient")
-			return
+		if !utils.IsValidEmail(addr.Address) {
+			fmt.Printf("%s is not a valid email, ignore\n", addr.Address)
+			continue
 		}
-	})
-	return err
+
+		res.recipient = append(res.recipient, addr)
+	}
+
+	if len(res.recipient) == 0 {
+		return fmt.Errorf("not any valid email address to be self recipient")
+	}
+
+	setting.Store(res)
+	return nil
 }
 
 func Send(subject string, msg string) error {
 	if !config.IsReady() {
 		panic("config is not ready")
-	} else if smtpAddress == "" || smtpUser == "" {
+	}
+
+	cfg := setting.Load()
+	if cfg == nil || cfg.address == "" || cfg.user == "" {
 		return nil
 	}
 
 	subject = fmt.Sprintf("【%s 消息提醒】 %s", config.GetConfig().SystemName, subject)
 	now := time.Now()
 
-	err := _sendTo(subject, msg, nil, nil, smtpRecipient, "", now)
+	err := _sendTo(cfg, subject, msg, nil, nil, cfg.recipient, "", now)
 	if err != nil {
 		return err
 	}
@@ -82,8 +105,8 @@ func Send(subject string, msg string) error {
 	return nil
 }
 
-func _sendTo(subject string, msg string, fromAddr *mail.Address, replyToAddr *mail.Address, toAddr []*mail.Address, messageID string, t time.Time) (err error) {
-	if smtpAddress == "" || smtpUser == "" {
+func _sendTo(cfg *smtpSetting, subject string, msg string, fromAddr *mail.Address, replyToAddr *mail.Address, toAddr []*mail.Address, messageID string, t time.Time) (err error) {
+	if cfg.address == "" || cfg.user == "" {
 		return nil
 	}
 
@@ -98,12 +121,12 @@ func _sendTo(subject string, msg string, fromAddr *mail.Address, replyToAddr *ma
 		}
 	}()
 
-	sender := smtpUser
+	sender := cfg.user
 
 	if fromAddr == nil {
 		fromAddr = &mail.Address{
 			Name:    config.GetConfig().SystemName,
-			Address: smtpUser,
+			Address: cfg.user,
 		}
 	}
 
@@ -115,11 +138,11 @@ func _sendTo(subject string, msg string, fromAddr *mail.Address, replyToAddr *ma
 	}
 
 	const missingPort = "missing port in address"
-	host, port, err := net.SplitHostPort(smtpAddress)
+	host, port, err := net.SplitHostPort(cfg.address)
 	var addrErr *net.AddrError
 	if errors.As(err, &addrErr) {
 		if addrErr.Err == missingPort {
-			host = smtpAddress
+			host = cfg.address
 			port = "25"
 		} else {
 			return err
@@ -179,11 +202,11 @@ func _sendTo(subject string, msg string, fromAddr *mail.Address, replyToAddr *ma
 	if canAuth {
 		var auth smtp.Auth
 		if strings.Contains(options, "CRAM-MD5") {
-			auth = smtp.CRAMMD5Auth(sender, smtpPassword)
+			auth = smtp.CRAMMD5Auth(sender, cfg.password)
 		} else if strings.Contains(options, "PLAIN") {
-			auth = smtp.PlainAuth("", sender, smtpPassword, host)
+			auth = smtp.PlainAuth("", sender, cfg.password, host)
 		} else if strings.Contains(options, "LOGIN") {
-			auth = LoginAuth(sender, smtpPassword)
+			auth = LoginAuth(sender, cfg.password)
 		}
 
 		if auth != nil {
@@ -220,7 +243,7 @@ func _sendTo(subject string, msg string, fromAddr *mail.Address, replyToAddr *ma
 	}
 
 	if fromAddr.Address == "" {
-		fromAddr.Address = smtpUser
+		fromAddr.Address = cfg.user
 	}
 
 	gomsg := gomail.NewMessage()
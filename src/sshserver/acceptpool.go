@@ -0,0 +1,192 @@
+package sshserver
+
+import (
+	"github.com/SongZihuan/ssh-watcher/src/logger"
+	"net"
+	"sync/atomic"
+	"time"
+)
+
+// DecisionBuckets 判定耗时直方图的分桶上限
+var DecisionBuckets = []time.Duration{
+	5 * time.Millisecond,
+	10 * time.Millisecond,
+	25 * time.Millisecond,
+	50 * time.Millisecond,
+	100 * time.Millisecond,
+	250 * time.Millisecond,
+	500 * time.Millisecond,
+	1 * time.Second,
+	2500 * time.Millisecond,
+	5 * time.Second,
+	10 * time.Second,
+	30 * time.Second,
+}
+
+const queueFullWarnInterval = time.Minute
+
+const decisionTimeoutMark = "超过判定时限（decision-timeout）。"
+
+// pendingConn 已经接受、等待检查的连接
+type pendingConn struct {
+	conn     net.Conn
+	l        *listener
+	accepted time.Time
+}
+
+// acceptWorker 检查新连接的工作协程
+type acceptWorker struct {
+	busySince atomic.Int64 // 开始检查当前连接的时间（UnixNano），0 表示空闲
+}
+
+func (w *acceptWorker) busy() time.Duration {
+	since := w.busySince.Load()
+	if since == 0 {
+		return 0
+	}
+
+	return time.Since(time.Unix(0, since))
+}
+
+// acceptStats 新连接检查的统计数据
+type acceptStats struct {
+	queueFull       atomic.Int64   // 因排队已满被拒绝的连接数
+	queueFullWarned atomic.Int64   // 上次输出排队已满日志的时间（UnixNano）
+	timeouts        atomic.Int64   // 超过判定时限的连接数
+	buckets         []atomic.Int64 // 判定耗时直方图（非累计），最后一个为超出全部分桶的数量
+	sum             atomic.Int64   // 判定耗时总和（纳秒）
+}
+
+func newAcceptStats() *acceptStats {
+	return &acceptStats{
+		buckets: make([]atomic.Int64, len(DecisionBuckets)+1),
+	}
+}
+
+func (a *acceptStats) observe(d time.Duration) {
+	i := 0
+	for i < len(DecisionBuckets) && d > DecisionBuckets[i] {
+		i++
+	}
+
+	a.buckets[i].Add(1)
+	a.sum.Add(int64(d))
+}
+
+// AcceptMetrics 一个转发的新连接检查的监控指标
+type AcceptMetrics struct {
+	Forward          string
+	Workers          int
+	WorkersBusy      int
+	QueueDepth       int
+	QueueCapacity    int
+	QueueFull        int64
+	DecisionTimeouts int64
+	DecisionBuckets  []int64 // 累计数量，与 DecisionBuckets 对应
+	DecisionCount    int64
+	DecisionSum      time.Duration
+	RateLimited      map[string]int64 // 按范围（RateScopes）累计因速率限制被丢弃的连接数
+}
+
+func (s *SshServer) AcceptMetrics() AcceptMetrics {
+	res := AcceptMetrics{
+		Forward:          s.getConfig().Name,
+		Workers:          len(s.workers),
+		QueueDepth:       len(s.queue),
+		QueueCapacity:    cap(s.queue),
+		QueueFull:        s.acceptStats.queueFull.Load(),
+		DecisionTimeouts: s.acceptStats.timeouts.Load(),
+		DecisionBuckets:  make([]int64, len(DecisionBuckets)),
+		DecisionSum:      time.Duration(s.acceptStats.sum.Load()),
+		RateLimited:      s.connRate.droppedTotal(),
+	}
+
+	for _, w := range s.workers {
+		if w.busySince.Load() != 0 {
+			res.WorkersBusy++
+		}
+	}
+
+	total := int64(0)
+	for i := range DecisionBuckets {
+		total += s.acceptStats.buckets[i].Load()
+		res.DecisionBuckets[i] = total
+	}
+	res.DecisionCount = total + s.acceptStats.buckets[len(DecisionBuckets)].Load()
+
+	return res
+}
+
+// enqueue 将新连接交给工作协程检查，排队已满时直接关闭连接（不记录到数据库，避免连接过多时拖慢监听）
+func (s *SshServer) enqueue(p *pendingConn) {
+	select {
+	case s.queue <- p:
+		return
+	default:
+		// pass
+	}
+
+	_ = p.conn.Close()
+	s.acceptStats.queueFull.Add(1)
+
+	now := time.Now().UnixNano()
+	last := s.acceptStats.queueFullWarned.Load()
+	if now-last >= int64(queueFullWarnInterval) && s.acceptStats.queueFullWarned.CompareAndSwap(last, now) {
+		logger.Warnf("forward %s accept queue is full (%d), new connections are rejected", s.getConfig().Name, cap(s.queue))
+	}
+}
+
+func (s *SshServer) work(w *acceptWorker) {
+	defer s.wwg.Done()
+
+	for {
+		select {
+		case <-s.stopchan:
+			return
+		case p := <-s.queue:
+			select {
+			case <-s.stopchan:
+				_ = p.conn.Close()
+				return
+			default:
+				// pass
+			}
+
+			w.busySince.Store(time.Now().UnixNano())
+			s.check(p)
+			w.busySince.Store(0)
+		}
+	}
+}
+
+// drainQueue 关闭仍在排队的连接，在工作协程退出后调用
+func (s *SshServer) drainQueue() {
+	for {
+		select {
+		case p := <-s.queue:
+			_ = p.conn.Close()
+		default:
+			return
+		}
+	}
+}
+
+// deadlineExceeded 连接已超过判定时限，超过时计入统计
+func (s *SshServer) deadlineExceeded(deadline time.Time) bool {
+	if deadline.IsZero() || time.Now().Before(deadline) {
+		return false
+	}
+
+	s.acceptStats.timeouts.Add(1)
+	return true
+}
+
+// earlier 返回 d 之后和 deadline 中较早的时间，deadline 为零值时表示不限制
+func earlier(d time.Duration, deadline time.Time) time.Time {
+	t := time.Now().Add(d)
+	if !deadline.IsZero() && deadline.Before(t) {
+		return deadline
+	}
+
+	return t
+}
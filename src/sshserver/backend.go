@@ -0,0 +1,321 @@
+package sshserver
+
+import (
+	"bufio"
+	"fmt"
+	"github.com/SongZihuan/ssh-watcher/src/config"
+	"github.com/SongZihuan/ssh-watcher/src/logger"
+	"github.com/SongZihuan/ssh-watcher/src/notify"
+	"github.com/pires/go-proxyproto"
+	"hash/fnv"
+	"net"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+type backend struct {
+	address string   // 用于记录和显示，Unix 套接字带有 unix: 前缀
+	addr    net.Addr // *net.TCPAddr 或 *net.UnixAddr
+	network string   // tcp4、tcp6 或 unix
+	backup  bool
+
+	proxy        bool // 健康检查时是否先发送 Proxy 协议头部（LOCAL）
+	proxyVersion int
+
+	healthy atomic.Bool
+	conns   atomic.Int64
+
+	success int64 // 连续成功次数，受 backendPool.lock 保护
+	failure int64 // 连续失败次数，受 backendPool.lock 保护
+}
+
+type backendPool struct {
+	forward     string
+	strategy    string
+	backends    []*backend
+	healthCheck *config.SshHealthCheckConfig // nil 表示不进行健康检查
+
+	lock     sync.Mutex
+	rr       atomic.Uint64
+	wg       sync.WaitGroup
+	stopchan chan bool
+}
+
+func newBackendPool(cfg *config.SshForwardConfig) *backendPool {
+	res := &backendPool{
+		forward:  cfg.Name,
+		strategy: cfg.Strategy,
+		backends: make([]*backend, 0, len(cfg.Backends)),
+	}
+
+	if cfg.HealthCheck.IsEnable() {
+		res.healthCheck = &cfg.HealthCheck
+	}
+
+	for _, b := range cfg.Backends {
+		var item *backend
+		if b.ResolveUnixAddress != nil {
+			item = newBackend(b.ResolveUnixAddress, b.Network)
+		} else {
+			item = newBackend(b.ResolveAddress, b.Network)
+		}
+		item.backup = b.Backup.IsEnable(false)
+
+		if item.network == "tcp6" {
+			item.proxy = cfg.IPv6DestRequestProxy.IsEnable(false)
+			item.proxyVersion = cfg.IPv6DestRequestProxyVersion
+		} else {
+			item.proxy = cfg.IPv4DestRequestProxy.IsEnable(false)
+			item.proxyVersion = cfg.IPv4DestRequestProxyVersion
+		}
+
+		res.backends = append(res.backends, item)
+	}
+
+	return res
+}
+
+func newSingleBackendPool(forward string, addr net.Addr, network string) *backendPool {
+	item := newBackend(addr, network)
+
+	return &backendPool{
+		forward:  forward,
+		strategy: config.BackendStrategyPrimaryBackup,
+		backends: []*backend{item},
+	}
+}
+
+func newBackend(addr net.Addr, network string) *backend {
+	res := &backend{
+		address: addr.String(),
+		addr:    addr,
+		network: network,
+	}
+
+	if network == "unix" {
+		res.address = config.UnixAddressPrefix + addr.String()
+	}
+
+	res.healthy.Store(true)
+	return res
+}
+
+func (p *backendPool) String() string {
+	if len(p.backends) == 1 {
+		return p.backends[0].address
+	}
+
+	addrs := make([]string, 0, len(p.backends))
+	for _, b := range p.backends {
+		addrs = append(addrs, b.address)
+	}
+
+	return strings.Join(addrs, ",")
+}
+
+// candidates 按照策略返回本次连接尝试的回源地址顺序，可用的地址在前，不可用的地址在后（仅作为最后的尝试）
+func (p *backendPool) candidates(ip net.IP) []*backend {
+	if len(p.backends) == 1 {
+		return p.backends
+	}
+
+	n := len(p.backends)
+	ordered := make([]*backend, 0, n)
+
+	switch p.strategy {
+	case config.BackendStrategyRoundRobin:
+		start := int((p.rr.Add(1) - 1) % uint64(n))
+		ordered = append(ordered, p.backends[start:]...)
+		ordered = append(ordered, p.backends[:start]...)
+	case config.BackendStrategySourceHash:
+		h := fnv.New32a()
+		_, _ = h.Write(ip)
+		start := int(h.Sum32() % uint32(n))
+		ordered = append(ordered, p.backends[start:]...)
+		ordered = append(ordered, p.backends[:start]...)
+	case config.BackendStrategyLeastConn:
+		ordered = append(ordered, p.backends...)
+		sort.SliceStable(ordered, func(i, j int) bool {
+			return ordered[i].conns.Load() < ordered[j].conns.Load()
+		})
+	default: // primary-backup
+		for _, b := range p.backends {
+			if !b.backup {
+				ordered = append(ordered, b)
+			}
+		}
+
+		for _, b := range p.backends {
+			if b.backup {
+				ordered = append(ordered, b)
+			}
+		}
+	}
+
+	res := make([]*backend, 0, n)
+	for _, b := range ordered {
+		if b.healthy.Load() {
+			res = append(res, b)
+		}
+	}
+
+	for _, b := range ordered {
+		if !b.healthy.Load() {
+			res = append(res, b)
+		}
+	}
+
+	return res
+}
+
+func (p *backendPool) start() {
+	if p.healthCheck == nil || p.stopchan != nil {
+		return
+	}
+
+	p.stopchan = make(chan bool)
+
+	p.wg.Add(1)
+	go func() {
+		defer p.wg.Done()
+
+		defer func() {
+			if r := recover(); r != nil {
+				logger.Panicf("forward %s health check panic: %v", p.forward, r)
+			}
+		}()
+
+		ticker := time.NewTicker(p.healthCheck.IntervalDuration)
+		defer ticker.Stop()
+
+	MainCycle:
+		for {
+			p.checkAll()
+
+			select {
+			case <-p.stopchan:
+				break MainCycle
+			case <-ticker.C:
+				// pass
+			}
+		}
+	}()
+}
+
+func (p *backendPool) stop() {
+	if p.stopchan == nil {
+		return
+	}
+
+	close(p.stopchan)
+	p.wg.Wait()
+
+	p.stopchan = nil // 重载配置时可能已经停止过一次
+}
+
+func (p *backendPool) checkAll() {
+	var wg sync.WaitGroup
+
+	for _, b := range p.backends {
+		wg.Add(1)
+		go func(b *backend) {
+			defer wg.Done()
+
+			err := p.check(b)
+			if err != nil {
+				p.report(b, false, err.Error())
+			} else {
+				p.report(b, true, "健康检查通过")
+			}
+		}(b)
+	}
+
+	wg.Wait()
+}
+
+func (p *backendPool) check(b *backend) error {
+	conn, err := net.DialTimeout(b.network, b.addr.String(), p.healthCheck.TimeoutDuration)
+	if err != nil {
+		return fmt.Errorf("健康检查连接失败：%s", err.Error())
+	}
+	defer func() {
+		_ = conn.Close()
+	}()
+
+	if p.healthCheck.Type != config.HealthCheckSSHBanner {
+		return nil
+	}
+
+	err = conn.SetDeadline(time.Now().Add(p.healthCheck.TimeoutDuration))
+	if err != nil {
+		return fmt.Errorf("健康检查设置超时失败：%s", err.Error())
+	}
+
+	if b.proxy {
+		_, err = proxyproto.HeaderProxyFromAddrs(byte(b.proxyVersion), nil, nil).WriteTo(conn)
+		if err != nil {
+			return fmt.Errorf("健康检查写入Proxy协议头部失败：%s", err.Error())
+		}
+	}
+
+	reader := bufio.NewReader(conn)
+	for i := 0; i < 16; i++ { // 服务端可以在标识字符串前发送其他行
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			return fmt.Errorf("健康检查读取SSH标识失败：%s", err.Error())
+		}
+
+		if strings.HasPrefix(line, "SSH-") {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("健康检查未读取到SSH标识")
+}
+
+func (p *backendPool) report(b *backend, ok bool, reason string) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	if ok {
+		b.failure = 0
+		b.success++
+
+		if !b.healthy.Load() && b.success >= p.healthCheck.Rise {
+			b.healthy.Store(true)
+			logger.Warnf("forward %s backend %s is up: %s", p.forward, b.address, reason)
+			notify.SendSshBackendStatus(p.forward, b.address, true, reason)
+		}
+	} else {
+		b.success = 0
+		b.failure++
+
+		if b.healthy.Load() && b.failure >= p.healthCheck.Fall {
+			b.healthy.Store(false)
+			logger.Warnf("forward %s backend %s is down: %s", p.forward, b.address, reason)
+			notify.SendSshBackendStatus(p.forward, b.address, false, reason)
+		}
+	}
+}
+
+// dialFailed 转发时连接回源地址失败，直接标记为不可用，等待健康检查恢复
+func (p *backendPool) dialFailed(b *backend, err error) {
+	if p.healthCheck == nil {
+		return // 没有健康检查则无法恢复，因此不做标记
+	}
+
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	b.success = 0
+	if b.healthy.Load() {
+		b.healthy.Store(false)
+
+		reason := fmt.Sprintf("转发连接失败：%s", err.Error())
+		logger.Warnf("forward %s backend %s is down: %s", p.forward, b.address, reason)
+		notify.SendSshBackendStatus(p.forward, b.address, false, reason)
+	}
+}
@@ -0,0 +1,195 @@
+package sshserver
+
+import (
+	"fmt"
+	"github.com/SongZihuan/ssh-watcher/src/config"
+	"net"
+	"sync"
+	"time"
+)
+
+// rateLimiter 令牌桶，桶容量为一秒的流量
+type rateLimiter struct {
+	rate  float64 // 每秒字节数
+	burst float64
+
+	lock   sync.Mutex
+	tokens float64
+	last   time.Time
+}
+
+func newRateLimiter(rate int64) *rateLimiter {
+	return &rateLimiter{
+		rate:   float64(rate),
+		burst:  float64(rate),
+		tokens: float64(rate),
+		last:   time.Now(),
+	}
+}
+
+// reserve 取出 n 字节的令牌并返回需要等待的时间，令牌不足时允许透支，由等待时间补偿
+func (l *rateLimiter) reserve(n int) time.Duration {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	now := time.Now()
+	l.tokens += now.Sub(l.last).Seconds() * l.rate
+	if l.tokens > l.burst {
+		l.tokens = l.burst
+	}
+	l.last = now
+
+	l.tokens -= float64(n)
+	if l.tokens >= 0 {
+		return 0
+	}
+
+	return time.Duration(-l.tokens / l.rate * float64(time.Second))
+}
+
+type sharedRateLimiter struct {
+	limiter *rateLimiter
+	refs    int64
+}
+
+// rateLimiterGroup 按 key 共享的令牌桶（例如同一来源IP、同一规则），没有会话引用时删除
+type rateLimiterGroup struct {
+	lock     sync.Mutex
+	limiters map[string]*sharedRateLimiter
+}
+
+func newRateLimiterGroup() *rateLimiterGroup {
+	return &rateLimiterGroup{
+		limiters: make(map[string]*sharedRateLimiter, 10),
+	}
+}
+
+func (g *rateLimiterGroup) acquire(key string, rate int64) *rateLimiter {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+
+	key = fmt.Sprintf("%s/%d", key, rate) // 限速值改变（例如重载配置）后使用新的令牌桶
+
+	l, ok := g.limiters[key]
+	if !ok {
+		l = &sharedRateLimiter{
+			limiter: newRateLimiter(rate),
+		}
+		g.limiters[key] = l
+	}
+
+	l.refs++
+	return l.limiter
+}
+
+func (g *rateLimiterGroup) release(limiter *rateLimiter) {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+
+	for key, l := range g.limiters {
+		if l.limiter != limiter {
+			continue
+		}
+
+		l.refs--
+		if l.refs <= 0 {
+			delete(g.limiters, key)
+		}
+		return
+	}
+}
+
+// sessionBandwidth 一个会话在两个方向上需要遵守的全部令牌桶
+type sessionBandwidth struct {
+	group *rateLimiterGroup
+
+	upload   []*rateLimiter
+	download []*rateLimiter
+	shared   []*rateLimiter // 从 group 中获取，会话结束时释放
+}
+
+func newSessionBandwidth(group *rateLimiterGroup, cfg *config.SshForwardBandwidthConfig, ip net.IP, rule *config.SshRuleConfig) *sessionBandwidth {
+	res := &sessionBandwidth{
+		group: group,
+	}
+
+	if cfg.Session.UploadLimit > 0 {
+		res.upload = append(res.upload, newRateLimiter(cfg.Session.UploadLimit))
+	}
+
+	if cfg.Session.DownloadLimit > 0 {
+		res.download = append(res.download, newRateLimiter(cfg.Session.DownloadLimit))
+	}
+
+	if cfg.IP.UploadLimit > 0 {
+		res.upload = append(res.upload, res.acquire(fmt.Sprintf("ip/upload/%s", ip.String()), cfg.IP.UploadLimit))
+	}
+
+	if cfg.IP.DownloadLimit > 0 {
+		res.download = append(res.download, res.acquire(fmt.Sprintf("ip/download/%s", ip.String()), cfg.IP.DownloadLimit))
+	}
+
+	if rule != nil && rule.Bandwidth.UploadLimit > 0 {
+		res.upload = append(res.upload, res.acquire(fmt.Sprintf("rule/upload/%p", rule), rule.Bandwidth.UploadLimit))
+	}
+
+	if rule != nil && rule.Bandwidth.DownloadLimit > 0 {
+		res.download = append(res.download, res.acquire(fmt.Sprintf("rule/download/%p", rule), rule.Bandwidth.DownloadLimit))
+	}
+
+	return res
+}
+
+func (b *sessionBandwidth) acquire(key string, rate int64) *rateLimiter {
+	l := b.group.acquire(key, rate)
+	b.shared = append(b.shared, l)
+	return l
+}
+
+func (b *sessionBandwidth) release() {
+	for _, l := range b.shared {
+		b.group.release(l)
+	}
+	b.shared = nil
+}
+
+// bufferSize 限速较低时减小每次读取的字节数，使流量更平滑
+func bufferSize(limiters []*rateLimiter) int {
+	size := 32 * 1024
+
+	for _, l := range limiters {
+		if int(l.rate) < size {
+			size = int(l.rate)
+		}
+	}
+
+	if size < 512 {
+		size = 512
+	}
+
+	return size
+}
+
+// wait 从所有令牌桶中取出 n 字节的令牌并等待，done 被关闭时返回 false
+func wait(limiters []*rateLimiter, n int, done chan bool) bool {
+	var d time.Duration
+	for _, l := range limiters {
+		if w := l.reserve(n); w > d {
+			d = w
+		}
+	}
+
+	if d <= 0 {
+		return true
+	}
+
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return true
+	case <-done:
+		return false
+	}
+}
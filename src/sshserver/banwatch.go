@@ -0,0 +1,175 @@
+package sshserver
+
+import (
+	"fmt"
+	"github.com/SongZihuan/ssh-watcher/src/config"
+	"github.com/SongZihuan/ssh-watcher/src/database"
+	"github.com/SongZihuan/ssh-watcher/src/logger"
+	"github.com/SongZihuan/ssh-watcher/src/notify"
+	"github.com/SongZihuan/ssh-watcher/src/redisserver"
+	"time"
+)
+
+// kickBanWatch 封禁情况可能发生了变化（重载配置、Redis 中新的封禁），立即检查一次已建立的会话
+func (s *SshServer) kickBanWatch() {
+	select {
+	case s.banKick <- true:
+	default:
+		// 已经在等待检查
+	}
+}
+
+// banWatchCycle 定期检查已建立的会话的来源是否被封禁，转发结束（包括停止和重载后被替换时等待会话结束）后退出
+func (s *SshServer) banWatchCycle() {
+	interval := s.getConfig().BanWatch.IntervalDuration
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+		case <-s.banKick:
+		}
+
+		if s.status.Load() == StatusFinished {
+			return
+		}
+
+		s.banWatch()
+
+		if i := s.getConfig().BanWatch.IntervalDuration; i != interval { // 重载配置后使用新的间隔
+			interval = i
+			ticker.Reset(interval)
+		}
+	}
+}
+
+func (s *SshServer) banWatch() {
+	cfg := s.getConfig()
+	if !cfg.BanWatch.IsEnable() {
+		return
+	}
+
+	for _, sess := range s.activeSessions() {
+		if sess.isFinished() || sess.banAlert.Load() != nil {
+			continue
+		}
+
+		err := s.banCheck(cfg, sess)
+		if err != nil {
+			s.onSessionBanned(cfg, sess, err.Error())
+		}
+	}
+}
+
+// onSessionBanned 会话的来源已被封禁：enforce 模式下断开会话，alert 模式下只推送一次消息，并在会话结束时写入数据库记录的备注
+func (s *SshServer) onSessionBanned(cfg *config.SshForwardConfig, sess *session, reason string) {
+	if cfg.BanWatch.Mode == config.BanWatchModeEnforce {
+		mark := fmt.Sprintf("会话建立后来源被封禁，连接被断开：%s", reason)
+		if !sess.close(database.DisconnectBanned, mark) {
+			return
+		}
+
+		logger.Warnf("forward %s close session of banned source: %s", cfg.Name, sess.String())
+		notify.SendSshBanned(cfg.Name, sess.ip.String(), sess.loc, sess.recordCopy().To, mark)
+		return
+	}
+
+	mark := fmt.Sprintf("会话建立后来源被封禁（仅提醒，未断开连接）：%s", reason)
+	if !sess.banAlert.CompareAndSwap(nil, &mark) {
+		return
+	}
+
+	logger.Warnf("forward %s session of banned source is still active: %s", cfg.Name, sess.String())
+	notify.SendSshBanned(cfg.Name, sess.ip.String(), sess.loc, sess.recordCopy().To, mark)
+}
+
+// banCheck 按照 remoteAddrCheck 和 hasshCheck 的顺序检查已建立的会话的来源（IP、定位和客户端指纹）现在是否被封禁。
+// 不进行计数规则的统计，只检查已经写入 Redis 的封禁；查询出错时不视为封禁。
+func (s *SshServer) banCheck(cfg *config.SshForwardConfig, sess *session) error {
+	ip := sess.ip
+	loc := sess.loc
+	hassh := sess.getHASSH()
+
+	isLoopback := ip.IsLoopback()
+	isIntranet := isLoopback || ip.IsPrivate()
+
+	if isLoopback && (cfg.ResolveRuleList.AlwaysAllowIntranet.IsEnable(false) || cfg.ResolveRuleList.AlwaysAllowLoopback.IsEnable(true)) {
+		return nil
+	}
+
+	if !database.SshCheckIP(ip.String()) {
+		return fmt.Errorf("IP地址被SQLite中定义的规则（IP）封禁。")
+	}
+
+	if hassh != "" && !redisserver.QuerySSHHASSHBanned(hassh) {
+		return fmt.Errorf("客户端指纹已被Redis封禁。")
+	}
+
+	if hassh != "" && !database.SshCheckHASSH(hassh) {
+		return fmt.Errorf("客户端指纹被SQLite中定义的规则封禁。")
+	}
+
+	if isIntranet && cfg.ResolveRuleList.AlwaysAllowIntranet.IsEnable(false) {
+		return nil
+	}
+
+	if loc == nil {
+		return nil
+	}
+
+	if !database.SshCheckLocationNation(loc.Nation) {
+		return fmt.Errorf("IP地址被SQLite中定义的规则（地区-国家）封禁。")
+	}
+
+	if !database.SshCheckLocationProvince(loc.Province) {
+		return fmt.Errorf("IP地址被SQLite中定义的规则（地区-省份）封禁。")
+	}
+
+	if !database.SshCheckLocationCity(loc.City) {
+		return fmt.Errorf("IP地址被SQLite中定义的规则（地区-城市）封禁。")
+	}
+
+	if !database.SshCheckLocationISP(loc.Isp) {
+		return fmt.Errorf("IP地址被SQLite中定义的规则（地区-ISP）封禁。")
+	}
+
+	if !redisserver.QuerySSHIpBanned(ip.String()) {
+		return fmt.Errorf("IP已被Redis封禁。")
+	}
+
+	clientVersion := sess.recordCopy().ClientVersion.String
+
+	for _, r := range cfg.ResolveRuleList.RuleList {
+		if r.HasHASSH() { // 与 hasshCheck 相同，指纹规则只用于封禁
+			if hassh == "" || !r.CheckHASSH(hassh) {
+				continue
+			}
+
+			ok, err := s.ruleMatch(r, ip, loc, clientVersion)
+			if err == nil && ok && r.Banned.ToBool(true) {
+				return fmt.Errorf("客户端指纹在配置文件规则策略中被封禁。")
+			}
+			continue
+		}
+
+		ok, err := s.ruleMatch(r, ip, loc, clientVersion)
+		if err != nil {
+			return nil
+		} else if !ok {
+			continue
+		}
+
+		if r.Banned.ToBool(true) { // true - 封禁
+			return fmt.Errorf("IP在配置文件规则策略中被封禁。")
+		}
+
+		return nil
+	}
+
+	if cfg.ResolveRuleList.DefaultBanned.ToBool(true) { // true - 封禁
+		return fmt.Errorf("IP在配置文件默认兜底规则策略中被封禁。")
+	}
+
+	return nil
+}
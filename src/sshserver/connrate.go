@@ -0,0 +1,300 @@
+package sshserver
+
+import (
+	"fmt"
+	"github.com/SongZihuan/ssh-watcher/src/config"
+	"github.com/SongZihuan/ssh-watcher/src/database"
+	"github.com/SongZihuan/ssh-watcher/src/logger"
+	"net"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	RateScopeIP     = "ip"
+	RateScopeNet    = "net"
+	RateScopeGlobal = "global"
+)
+
+// RateScopes 速率限制的范围，按照检查的顺序排列
+var RateScopes = []string{RateScopeIP, RateScopeNet, RateScopeGlobal}
+
+// connBucket 新连接的令牌桶，由 connRateLimiter 加锁访问
+type connBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// refill 按照经过的时间补充令牌，返回补充后的令牌数
+func (b *connBucket) refill(cfg *config.SshConnRateConfig, now time.Time) float64 {
+	burst := float64(cfg.Count)
+	b.tokens += now.Sub(b.last).Seconds() * burst / cfg.PeriodDuration.Seconds()
+	if b.tokens > burst {
+		b.tokens = burst
+	}
+	b.last = now
+
+	return b.tokens
+}
+
+type rateDropKey struct {
+	scope  string
+	source string
+}
+
+// connRateLimiter 新连接的速率限制（来源IP、来源网段和全局），在IP定位和数据库查询之前丢弃超出限制的连接。
+// 被丢弃的连接只在内存中计数，定期汇总写入数据库。
+type connRateLimiter struct {
+	lock   sync.Mutex
+	cfg    *config.SshRateLimitConfig
+	ip     map[string]*connBucket
+	net    map[string]*connBucket
+	global *connBucket
+
+	dropped map[rateDropKey]int64 // 本汇总周期内被丢弃的连接数
+	since   time.Time             // 本汇总周期的开始时间
+	total   map[string]int64      // 按范围累计被丢弃的连接数（监控指标）
+}
+
+func newConnRateLimiter(cfg *config.SshRateLimitConfig) *connRateLimiter {
+	res := &connRateLimiter{
+		dropped: make(map[rateDropKey]int64, 10),
+		since:   time.Now(),
+		total:   make(map[string]int64, len(RateScopes)),
+	}
+
+	res.setConfig(cfg)
+
+	return res
+}
+
+// setConfig 重载配置时使用新的设定，限制改变时已有的令牌桶全部重置
+func (c *connRateLimiter) setConfig(cfg *config.SshRateLimitConfig) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	same := c.cfg != nil && sameConnRate(&c.cfg.IP, &cfg.IP) && sameConnRate(&c.cfg.Net, &cfg.Net) && sameConnRate(&c.cfg.Global, &cfg.Global)
+
+	c.cfg = cfg
+	if same {
+		return
+	}
+
+	c.ip = make(map[string]*connBucket, 10)
+	c.net = make(map[string]*connBucket, 10)
+	c.global = nil
+}
+
+func sameConnRate(a *config.SshConnRateConfig, b *config.SshConnRateConfig) bool {
+	return a.Count == b.Count && a.PeriodDuration == b.PeriodDuration
+}
+
+// allow 检查来自 ip 的新连接是否在速率限制内，通过时取出各个令牌桶的一个令牌，未通过时计数，不取出令牌
+func (c *connRateLimiter) allow(ip net.IP) bool {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if !c.cfg.IsEnable() {
+		return true
+	}
+
+	now := time.Now()
+	buckets := make([]*connBucket, 0, len(RateScopes))
+
+	for _, scope := range RateScopes {
+		cfg, source := c.scope(scope, ip)
+		if !cfg.IsEnable() {
+			continue
+		}
+
+		b := c.bucket(scope, source, cfg, now)
+		if b.refill(cfg, now) < 1 {
+			c.dropped[rateDropKey{scope: scope, source: source}]++
+			c.total[scope]++
+			return false
+		}
+
+		buckets = append(buckets, b)
+	}
+
+	for _, b := range buckets {
+		b.tokens -= 1
+	}
+
+	return true
+}
+
+func (c *connRateLimiter) scope(scope string, ip net.IP) (*config.SshConnRateConfig, string) {
+	switch scope {
+	case RateScopeIP:
+		return &c.cfg.IP, normalizeIP(ip).String()
+	case RateScopeNet:
+		return &c.cfg.Net, ipNetKey(ip)
+	default:
+		return &c.cfg.Global, ""
+	}
+}
+
+func (c *connRateLimiter) bucket(scope string, source string, cfg *config.SshConnRateConfig, now time.Time) *connBucket {
+	var m map[string]*connBucket
+	switch scope {
+	case RateScopeIP:
+		m = c.ip
+	case RateScopeNet:
+		m = c.net
+	default:
+		if c.global == nil {
+			c.global = &connBucket{tokens: float64(cfg.Count), last: now}
+		}
+		return c.global
+	}
+
+	b, ok := m[source]
+	if !ok {
+		b = &connBucket{tokens: float64(cfg.Count), last: now}
+		m[source] = b
+	}
+
+	return b
+}
+
+// summary 取出本汇总周期内被丢弃的连接（按数量从多到少排列），开始新的汇总周期，同时删除已经装满（长时间没有新连接）的令牌桶
+func (c *connRateLimiter) summary() (records []*database.SshRateLimitRecord, start time.Time, stop time.Time) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	start = c.since
+	stop = time.Now()
+
+	records = make([]*database.SshRateLimitRecord, 0, len(c.dropped))
+	for key, count := range c.dropped {
+		records = append(records, &database.SshRateLimitRecord{
+			Scope:   key.scope,
+			Source:  key.source,
+			Count:   count,
+			StartAt: start,
+			Time:    stop,
+		})
+	}
+
+	c.dropped = make(map[rateDropKey]int64, 10)
+	c.since = stop
+
+	c.cleanBuckets(c.ip, &c.cfg.IP, stop)
+	c.cleanBuckets(c.net, &c.cfg.Net, stop)
+
+	sort.Slice(records, func(i, j int) bool {
+		return records[i].Count > records[j].Count
+	})
+
+	return records, start, stop
+}
+
+func (c *connRateLimiter) cleanBuckets(m map[string]*connBucket, cfg *config.SshConnRateConfig, now time.Time) {
+	if !cfg.IsEnable() {
+		return
+	}
+
+	for key, b := range m {
+		if b.refill(cfg, now) >= float64(cfg.Count) {
+			delete(m, key)
+		}
+	}
+}
+
+// droppedTotal 按范围累计被丢弃的连接数
+func (c *connRateLimiter) droppedTotal() map[string]int64 {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	res := make(map[string]int64, len(RateScopes))
+	for _, scope := range RateScopes {
+		res[scope] = c.total[scope]
+	}
+
+	return res
+}
+
+// rateLimitSummary 汇总被丢弃的连接并写入数据库，记录数超过上限时合并数量较少的来源
+func (s *SshServer) rateLimitSummary() {
+	records, start, stop := s.connRate.summary()
+	if len(records) == 0 {
+		return
+	}
+
+	cfg := s.getConfig()
+	limit := int(cfg.RateLimit.SummaryMaxRecords)
+
+	byScope := make(map[string]int64, len(RateScopes))
+	for _, r := range records {
+		byScope[r.Scope] += r.Count
+	}
+
+	if len(records) > limit {
+		other := &database.SshRateLimitRecord{
+			Scope:   "*",
+			Source:  "*",
+			StartAt: start,
+			Time:    stop,
+		}
+
+		for _, r := range records[limit-1:] {
+			other.Count += r.Count
+		}
+
+		records = append(records[:limit-1], other)
+	}
+
+	for _, r := range records {
+		r.Forward = cfg.Name
+	}
+
+	logger.Warnf("forward %s rate limit dropped connections in %s: ip %d, net %d, global %d", cfg.Name,
+		stop.Sub(start).Round(time.Second), byScope[RateScopeIP], byScope[RateScopeNet], byScope[RateScopeGlobal])
+
+	err := database.AddSshRateLimitRecords(records)
+	if err != nil {
+		logger.Errorf("save rate limit records error: %s", err.Error())
+	}
+}
+
+// rateLimitCycle 定期汇总被丢弃的连接，停止时由 closeListeners 进行最后一次汇总
+func (s *SshServer) rateLimitCycle() {
+	defer s.lwg.Done()
+
+	interval := s.getConfig().RateLimit.SummaryIntervalDuration
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.stopchan:
+			return
+		case <-ticker.C:
+			s.rateLimitSummary()
+		}
+
+		if i := s.getConfig().RateLimit.SummaryIntervalDuration; i != interval { // 重载配置后使用新的间隔
+			interval = i
+			ticker.Reset(interval)
+		}
+	}
+}
+
+func normalizeIP(ip net.IP) net.IP {
+	if ip4 := ip.To4(); ip4 != nil {
+		return ip4
+	}
+
+	return ip
+}
+
+// ipNetKey 来源IP所在的网段，IPv4 为 /24，IPv6 为 /64
+func ipNetKey(ip net.IP) string {
+	if ip4 := ip.To4(); ip4 != nil {
+		return fmt.Sprintf("%s/24", ip4.Mask(net.CIDRMask(24, 32)).String())
+	}
+
+	return fmt.Sprintf("%s/64", ip.Mask(net.CIDRMask(64, 128)).String())
+}
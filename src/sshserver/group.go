@@ -0,0 +1,339 @@
+package sshserver
+
+import (
+	"context"
+	"fmt"
+	"github.com/SongZihuan/ssh-watcher/src/config"
+	"github.com/SongZihuan/ssh-watcher/src/logger"
+	"net"
+	"strings"
+	"sync"
+	"time"
+)
+
+// SshServerGroup 管理多个转发（每个转发一个 SshServer），统一启动和停止
+type SshServerGroup struct {
+	lock    sync.Mutex
+	servers []*SshServer
+	retired []*SshServer // 重载配置后被替换的转发，仍在等待已有的会话结束
+}
+
+// NewSshServerGroup 创建转发组，inherited 为外部传入的监听（按转发名称分组，例如 systemd 套接字激活），可以为 nil。
+// 有外部传入的监听的转发不再按照配置自行监听，没有对应转发的监听会被关闭。
+func NewSshServerGroup(cfgs []*config.SshForwardConfig, inherited map[string][]net.Listener) (*SshServerGroup, error) {
+	if len(cfgs) == 0 {
+		closeInherited(inherited)
+		return nil, fmt.Errorf("no forward")
+	}
+
+	res := &SshServerGroup{
+		servers: make([]*SshServer, 0, len(cfgs)),
+	}
+
+	for _, cfg := range cfgs {
+		ser, err := NewSshServer(cfg)
+		if err != nil {
+			closeInherited(inherited)
+			return nil, fmt.Errorf("forward %s: %s", cfg.Name, err.Error())
+		}
+
+		if lns, ok := inherited[cfg.Name]; ok {
+			ser.inherited = lns
+			delete(inherited, cfg.Name)
+		}
+
+		res.servers = append(res.servers, ser)
+	}
+
+	for name, lns := range inherited {
+		logger.Warnf("inherited listener %s does not match any forward, close it", name)
+		for _, ln := range lns {
+			_ = ln.Close()
+		}
+	}
+
+	return res, nil
+}
+
+func closeInherited(inherited map[string][]net.Listener) {
+	for _, lns := range inherited {
+		for _, ln := range lns {
+			_ = ln.Close()
+		}
+	}
+}
+
+func (g *SshServerGroup) Start() error {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+
+	for i, ser := range g.servers {
+		err := ser.Start()
+		if err != nil {
+			for _, started := range g.servers[:i] {
+				_ = started.Stop()
+			}
+
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Healthy 检查所有转发的 accept 循环是否正常
+func (g *SshServerGroup) Healthy(maxBusy time.Duration) error {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+
+	for _, ser := range g.servers {
+		err := ser.Healthy(maxBusy)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Listeners 所有转发正在使用的监听，按转发名称分组，用于升级时传给新进程
+func (g *SshServerGroup) Listeners() map[string][]net.Listener {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+
+	res := make(map[string][]net.Listener, len(g.servers))
+	for _, ser := range g.servers {
+		lns := ser.Listeners()
+		if len(lns) > 0 {
+			res[ser.getConfig().Name] = lns
+		}
+	}
+
+	return res
+}
+
+// AcceptMetrics 所有转发的新连接检查的监控指标
+func (g *SshServerGroup) AcceptMetrics() []AcceptMetrics {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+
+	res := make([]AcceptMetrics, 0, len(g.servers))
+	for _, ser := range g.servers {
+		res = append(res, ser.AcceptMetrics())
+	}
+
+	return res
+}
+
+// Sessions 所有转发（包括重载后被替换、仍在等待会话结束的转发）正在进行的会话
+func (g *SshServerGroup) Sessions() []SessionInfo {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+
+	res := make([]SessionInfo, 0, 10)
+	for _, ser := range g.all() {
+		res = append(res, ser.Sessions()...)
+	}
+
+	return res
+}
+
+// Kill 在所有转发中断开连接记录 ID 为 id 的会话，或者来自 ip 的全部会话（id 为 0 时），返回被断开的会话
+func (g *SshServerGroup) Kill(id uint, ip net.IP, note string) []SessionInfo {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+
+	res := make([]SessionInfo, 0, 1)
+	for _, ser := range g.all() {
+		res = append(res, ser.Kill(id, ip, note)...)
+	}
+
+	return res
+}
+
+func (g *SshServerGroup) all() []*SshServer {
+	res := make([]*SshServer, 0, len(g.servers)+len(g.retired))
+	res = append(res, g.servers...)
+	res = append(res, g.retired...)
+	return res
+}
+
+func (g *SshServerGroup) Stop() error {
+	return g.StopWithin(0)
+}
+
+// StopWithin 停止所有转发，drain 为等待会话结束的时长，0 表示使用各转发的设定，小于 0 表示一直等待
+func (g *SshServerGroup) StopWithin(drain time.Duration) error {
+	return g.StopContext(context.Background(), drain)
+}
+
+// StopContext 与 StopWithin 相同，但 ctx 结束时（例如等待期间再次收到退出信号）立即强制断开剩余的会话
+func (g *SshServerGroup) StopContext(ctx context.Context, drain time.Duration) error {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+
+	var wg sync.WaitGroup
+
+	for _, ser := range g.all() {
+		wg.Add(1)
+		go func(ser *SshServer) {
+			defer wg.Done()
+
+			d := drain
+			if d == 0 {
+				d = ser.getConfig().DrainTimeoutDuration
+			}
+
+			sctx, cancel := ctx, context.CancelFunc(func() {})
+			if d >= 0 {
+				sctx, cancel = context.WithTimeout(ctx, d)
+			}
+			defer cancel()
+
+			_ = ser.Shutdown(sctx)
+		}(ser)
+	}
+
+	wg.Wait()
+	return nil
+}
+
+// Reload 按照新的配置更新转发，返回每个转发的变化情况。
+// 监听端口和回源地址不变的转发只替换配置（规则、计数规则等），否则关闭旧的监听并启动新的转发。
+// 被替换或删除的转发不会断开已有的会话，会话结束前仍按旧的配置运行。
+func (g *SshServerGroup) Reload(cfgs []*config.SshForwardConfig) (changes []string, err error) {
+	if len(cfgs) == 0 {
+		return nil, fmt.Errorf("no forward")
+	}
+
+	g.lock.Lock()
+	defer g.lock.Unlock()
+
+	old := make(map[string]*SshServer, len(g.servers))
+	for _, ser := range g.servers {
+		old[ser.getConfig().Name] = ser
+	}
+
+	servers := make([]*SshServer, 0, len(cfgs))
+	changes = make([]string, 0, len(cfgs)+len(g.servers))
+	errs := make([]string, 0, len(cfgs))
+
+	// 先关闭需要替换和删除的转发的监听，以便新的转发可以使用相同的端口
+	restart := make([]*config.SshForwardConfig, 0, len(cfgs))
+	restartOld := make(map[string]*config.SshForwardConfig, len(cfgs))
+	for _, cfg := range cfgs {
+		ser, ok := old[cfg.Name]
+		if !ok {
+			restart = append(restart, cfg)
+			changes = append(changes, fmt.Sprintf("转发 %s：新增。", cfg.Name))
+			continue
+		}
+
+		delete(old, cfg.Name)
+
+		if listenKey(ser.getConfig()) == listenKey(cfg) {
+			ser.setConfig(cfg)
+			servers = append(servers, ser)
+			changes = append(changes, fmt.Sprintf("转发 %s：更新规则。", cfg.Name))
+			continue
+		}
+
+		restartOld[cfg.Name] = ser.getConfig()
+		ser.Retire()
+		g.retired = append(g.retired, ser)
+
+		restart = append(restart, cfg)
+		changes = append(changes, fmt.Sprintf("转发 %s：监听端口或回源地址变化，重启监听。", cfg.Name))
+	}
+
+	for name, ser := range old {
+		ser.Retire()
+		g.retired = append(g.retired, ser)
+		changes = append(changes, fmt.Sprintf("转发 %s：删除。", name))
+	}
+
+	for _, cfg := range restart {
+		ser, startErr := startSshServer(cfg)
+		if startErr == nil {
+			servers = append(servers, ser)
+			continue
+		}
+
+		logger.Errorf("reload forward %s failed: %s", cfg.Name, startErr.Error())
+
+		oldCfg, ok := restartOld[cfg.Name]
+		if !ok {
+			errs = append(errs, fmt.Sprintf("转发 %s 启动失败：%s", cfg.Name, startErr.Error()))
+			continue
+		}
+
+		ser, oldErr := startSshServer(oldCfg) // 回退到原来的配置
+		if oldErr != nil {
+			logger.Errorf("restore forward %s failed: %s", cfg.Name, oldErr.Error())
+			errs = append(errs, fmt.Sprintf("转发 %s 启动失败：%s；恢复原配置也失败：%s", cfg.Name, startErr.Error(), oldErr.Error()))
+			continue
+		}
+
+		servers = append(servers, ser)
+		errs = append(errs, fmt.Sprintf("转发 %s 启动失败，已恢复原配置：%s", cfg.Name, startErr.Error()))
+	}
+
+	g.servers = servers
+
+	retired := make([]*SshServer, 0, len(g.retired))
+	for _, ser := range g.retired {
+		if !ser.IsFinished() {
+			retired = append(retired, ser)
+		}
+	}
+	g.retired = retired
+
+	if len(errs) > 0 {
+		return changes, fmt.Errorf("%s", strings.Join(errs, "；"))
+	}
+
+	return changes, nil
+}
+
+func startSshServer(cfg *config.SshForwardConfig) (*SshServer, error) {
+	ser, err := NewSshServer(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	err = ser.Start()
+	if err != nil {
+		return nil, err
+	}
+
+	return ser, nil
+}
+
+// listenKey 汇总监听地址和回源地址相关的设定，这些设定变化时需要重启转发
+func listenKey(cfg *config.SshForwardConfig) string {
+	listens := make([]string, 0, len(cfg.ResolveListenAddresses))
+	for _, addr := range cfg.ResolveListenAddresses {
+		listens = append(listens, addr.String())
+	}
+
+	backends := make([]string, 0, len(cfg.Backends))
+	for _, b := range cfg.Backends {
+		backends = append(backends, fmt.Sprintf("%s/%v/%v/%s/%v", b.Address, b.ResolveAddress, b.ResolveUnixAddress, b.Network, b.Backup.IsEnable(false)))
+	}
+
+	routes := make([]string, 0, len(cfg.Mux.Routes))
+	if cfg.Mux.IsEnable() { // 转发目标与 muxPools 按序号对应
+		for _, r := range cfg.Mux.Routes {
+			routes = append(routes, fmt.Sprintf("%s/%s/%s/%s/%v/%d", r.Protocol, strings.Join(r.SNI, "|"), r.Dest, r.Backend.Network, r.Proxy.IsEnable(false), r.ProxyVersion))
+		}
+	}
+
+	return fmt.Sprintf("src=%s,%v,%v;accept=%d,%d;dest=%v,%v,%v,%v;proxy=%v/%d,%v/%d;backends=%s,%s,%+v;mux=%v,%s",
+		strings.Join(listens, ","), cfg.IPv4SrcServerProxy.IsEnable(false), cfg.IPv6SrcServerProxy.IsEnable(false),
+		cfg.Accept.Workers, cfg.Accept.Queue,
+		cfg.ResolveIPv4DestAddress, cfg.ResolveIPv6DestAddress, cfg.ResolveUnixDestAddress, cfg.Cross,
+		cfg.IPv4DestRequestProxy.IsEnable(false), cfg.IPv4DestRequestProxyVersion,
+		cfg.IPv6DestRequestProxy.IsEnable(false), cfg.IPv6DestRequestProxyVersion,
+		strings.Join(backends, ","), cfg.Strategy, cfg.HealthCheck,
+		cfg.Mux.IsEnable(), strings.Join(routes, ","))
+}
@@ -0,0 +1,110 @@
+package sshserver
+
+import (
+	"bytes"
+	"crypto/md5"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+)
+
+const (
+	maxKexInitPacketLength = 35000 // RFC 4253 6.1：实现至少需要支持的数据包长度
+	sshMsgKexInit          = 20
+)
+
+// kexInitParser 从客户端发往回源地址的数据中解析第一个数据包（SSH_MSG_KEXINIT），只读取数据不做修改
+type kexInitParser struct {
+	skipIdent  bool // 未读取标识行时（header-check 未启用），需要先跳过标识行
+	identBytes int
+	buf        []byte
+	done       bool
+	callback   func(hassh string, algorithms string)
+}
+
+func newKexInitParser(skipIdent bool, callback func(hassh string, algorithms string)) *kexInitParser {
+	return &kexInitParser{
+		skipIdent: skipIdent,
+		callback:  callback,
+	}
+}
+
+func (p *kexInitParser) write(data []byte) {
+	if p.done {
+		return
+	}
+
+	if p.skipIdent {
+		i := bytes.IndexByte(data, '\n')
+		if i < 0 {
+			p.identBytes += len(data)
+			if p.identBytes > maxIdentificationLength {
+				p.done = true
+			}
+			return
+		}
+
+		p.skipIdent = false
+		data = data[i+1:]
+	}
+
+	p.buf = append(p.buf, data...)
+	if len(p.buf) < 5 {
+		return
+	}
+
+	length := int(binary.BigEndian.Uint32(p.buf[:4]))
+	if length < 2 || length > maxKexInitPacketLength {
+		p.finish()
+		return
+	} else if len(p.buf) < 4+length {
+		return
+	}
+
+	packet := p.buf[4 : 4+length]
+	p.finish()
+
+	padding := int(packet[0])
+	if padding >= len(packet)-1 {
+		return
+	}
+
+	hassh, algorithms, ok := parseKexInit(packet[1 : len(packet)-padding])
+	if ok {
+		p.callback(hassh, algorithms)
+	}
+}
+
+func (p *kexInitParser) finish() {
+	p.done = true
+	p.buf = nil
+}
+
+// parseKexInit 按照 HASSH 的定义计算指纹：md5(kex;encryption_c2s;mac_c2s;compression_c2s)
+func parseKexInit(payload []byte) (hassh string, algorithms string, ok bool) {
+	if len(payload) < 17 || payload[0] != sshMsgKexInit {
+		return "", "", false
+	}
+
+	rest := payload[17:] // 消息类型 + 16字节 cookie
+
+	lists := make([]string, 0, 8)
+	for i := 0; i < 8; i++ { // kex, host key, enc c2s, enc s2c, mac c2s, mac s2c, comp c2s, comp s2c
+		if len(rest) < 4 {
+			return "", "", false
+		}
+
+		n := int(binary.BigEndian.Uint32(rest[:4]))
+		if n > len(rest)-4 {
+			return "", "", false
+		}
+
+		lists = append(lists, string(rest[4:4+n]))
+		rest = rest[4+n:]
+	}
+
+	algorithms = fmt.Sprintf("%s;%s;%s;%s", lists[0], lists[2], lists[4], lists[6])
+	sum := md5.Sum([]byte(algorithms))
+
+	return hex.EncodeToString(sum[:]), algorithms, true
+}
@@ -0,0 +1,170 @@
+package sshserver
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/SongZihuan/ssh-watcher/src/logger"
+	"net"
+	"time"
+)
+
+const maxHoldDataLength = 64 * 1024 // hold 期间最多缓存的客户端数据，超过后不再读取，由内核缓冲
+
+// startHold 连接回源地址失败时保持已通过检查的客户端连接，在 hold.window 内按退避时长重试，未启用时返回 false
+func (s *SshServer) startHold(a *authorizedConn, dialMark string) bool {
+	cfg := &s.getConfig().Hold
+	if !cfg.IsEnable() {
+		return false
+	}
+
+	logger.Warnf("forward %s hold %s for %s until the target is available", s.getConfig().Name, a.remoteSSHAddr.IP.String(), cfg.WindowDuration.String())
+
+	s.swg.Add(1)
+	go s.hold(a, dialMark, cfg.WindowDuration, cfg.BackoffDuration, cfg.MaxBackoffDuration)
+
+	return true
+}
+
+// holdProbe 在后台读取客户端连接，用于发现 hold 期间断开的客户端；读取到的数据需在转发开始时写入回源地址
+type holdProbe struct {
+	conn net.Conn
+	res  chan holdProbeResult // 为 nil 时表示没有正在进行的读取
+}
+
+type holdProbeResult struct {
+	data []byte
+	err  error
+}
+
+func (p *holdProbe) start() {
+	res := make(chan holdProbeResult, 1)
+	p.res = res
+
+	go func() {
+		buf := make([]byte, 1024)
+		n, err := p.conn.Read(buf)
+		res <- holdProbeResult{data: buf[:n], err: err}
+	}()
+}
+
+// stop 中断正在进行的读取并返回其结果，客户端已断开时返回错误
+func (p *holdProbe) stop() ([]byte, error) {
+	if p.res == nil {
+		return nil, nil
+	}
+
+	_ = p.conn.SetReadDeadline(time.Now())
+	r := <-p.res
+	p.res = nil
+	_ = p.conn.SetReadDeadline(time.Time{})
+
+	var netErr net.Error
+	if r.err != nil && errors.As(r.err, &netErr) && netErr.Timeout() {
+		return r.data, nil
+	}
+
+	return r.data, r.err
+}
+
+// hold 重试连接回源地址，成功后开始转发；超过 window、客户端断开、服务停止或重载后转发被替换时放弃
+func (s *SshServer) hold(a *authorizedConn, dialMark string, window time.Duration, backoff time.Duration, maxBackoff time.Duration) {
+	defer s.swg.Done()
+
+	defer func() {
+		if r := recover(); r != nil {
+			logger.Panicf("forward %s hold panic: %v", s.getConfig().Name, r)
+		}
+	}()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	go func() {
+		select {
+		case <-s.stopchan: // 服务停止时放弃正在进行的连接
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	start := time.Now()
+	expire := start.Add(window)
+	retry := 0
+
+	probe := &holdProbe{conn: a.conn}
+	probe.start()
+
+	stopped := func() {
+		_, _ = probe.stop()
+		s.reject(a, dialMark+fmt.Sprintf("等待回源地址恢复 %s 后转发停止，无法连接回源地址。", time.Since(start).Truncate(time.Second).String()))
+	}
+
+	gone := func() {
+		logger.Warnf("forward %s stop holding %s: client disconnected", s.getConfig().Name, a.remoteSSHAddr.IP.String())
+		s.reject(a, dialMark+fmt.Sprintf("等待回源地址恢复 %s 后客户端断开连接（重试 %d 次）。", time.Since(start).Truncate(time.Second).String(), retry))
+	}
+
+	for {
+		wait := backoff
+		if remain := time.Until(expire); remain < wait {
+			wait = remain
+		}
+
+		timer := time.NewTimer(wait)
+	WaitCycle:
+		for {
+			select {
+			case <-s.stopchan:
+				timer.Stop()
+				stopped()
+				return
+			case r := <-probe.res:
+				probe.res = nil
+				a.headerData = append(a.headerData, r.data...)
+				if r.err != nil {
+					timer.Stop()
+					gone()
+					return
+				}
+
+				if len(a.headerData) < maxHoldDataLength {
+					probe.start()
+				}
+			case <-timer.C:
+				break WaitCycle
+			}
+		}
+
+		retry++
+		target, b, mark, err := s.dialBackend(ctx, a.pool, a.remoteSSHAddr.IP, time.Time{}, true) // 最后一次重试在 window 结束时开始，仍使用完整的 dial-timeout
+		if err == nil {
+			data, err := probe.stop()
+			a.headerData = append(a.headerData, data...)
+			if err != nil {
+				_ = target.Close()
+				gone()
+				return
+			}
+
+			logger.Infof("forward %s target is available after holding %s for %s", s.getConfig().Name, a.remoteSSHAddr.IP.String(), time.Since(start).Truncate(time.Millisecond).String())
+			s.establish(a, target, b, dialMark+fmt.Sprintf("等待回源地址恢复 %s（重试 %d 次）。", time.Since(start).Truncate(time.Second).String(), retry)+mark)
+			return
+		} else if ctx.Err() != nil {
+			stopped()
+			return
+		}
+
+		if !time.Now().Before(expire) {
+			_, _ = probe.stop()
+			logger.Warnf("forward %s give up holding %s: target is still unavailable after %s", s.getConfig().Name, a.remoteSSHAddr.IP.String(), window.String())
+			s.reject(a, dialMark+fmt.Sprintf("等待回源地址恢复超过 %s（hold-expired，重试 %d 次），最后一次：", window.String(), retry)+mark+"无法连接回源地址。")
+			return
+		}
+
+		backoff *= 2
+		if backoff > maxBackoff {
+			backoff = maxBackoff
+		}
+	}
+}
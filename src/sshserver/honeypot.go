@@ -0,0 +1,256 @@
+package sshserver
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"database/sql"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"github.com/SongZihuan/ssh-watcher/src/api/apiip"
+	"github.com/SongZihuan/ssh-watcher/src/config"
+	"github.com/SongZihuan/ssh-watcher/src/database"
+	"github.com/SongZihuan/ssh-watcher/src/logger"
+	"golang.org/x/crypto/ssh"
+	"io"
+	"net"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+var honeypotSockets atomic.Int64 // 所有转发正在由蜜罐处理的连接数
+
+var honeypotSignerLock sync.Mutex
+var honeypotSigner ssh.Signer
+var honeypotSignerPath string // 已加载的密钥对应的 host-key
+
+var errHoneypotAuth = fmt.Errorf("permission denied")
+
+// prefixConn 先返回事先读取的数据（例如客户端标识行），再从连接中读取
+type prefixConn struct {
+	net.Conn
+	reader io.Reader
+}
+
+func newPrefixConn(conn net.Conn, prefix []byte) net.Conn {
+	if len(prefix) == 0 {
+		return conn
+	}
+
+	return &prefixConn{
+		Conn:   conn,
+		reader: io.MultiReader(bytes.NewReader(prefix), conn),
+	}
+}
+
+func (c *prefixConn) Read(p []byte) (int, error) {
+	return c.reader.Read(p)
+}
+
+// honeypotHostKey 返回蜜罐的主机密钥，只缓存加载成功的密钥；host-key 在重载后变化时重新加载，加载失败时下次调用会重试
+func honeypotHostKey(path string) (ssh.Signer, error) {
+	honeypotSignerLock.Lock()
+	defer honeypotSignerLock.Unlock()
+
+	if honeypotSigner != nil && honeypotSignerPath == path {
+		return honeypotSigner, nil
+	}
+
+	signer, err := loadHoneypotHostKey(path)
+	if err != nil {
+		return nil, err
+	}
+
+	honeypotSigner = signer
+	honeypotSignerPath = path
+	return signer, nil
+}
+
+// loadHoneypotHostKey 读取蜜罐的主机密钥，文件不存在时生成并保存，未设置文件时生成临时密钥
+func loadHoneypotHostKey(path string) (ssh.Signer, error) {
+	if path != "" {
+		data, err := os.ReadFile(path)
+		if err == nil {
+			return ssh.ParsePrivateKey(data)
+		} else if !errors.Is(err, os.ErrNotExist) {
+			return nil, err
+		}
+	}
+
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+
+	signer, err := ssh.NewSignerFromKey(key)
+	if err != nil || path == "" {
+		return signer, err
+	}
+
+	block, err := ssh.MarshalPrivateKey(key, "")
+	if err != nil {
+		return nil, err
+	}
+
+	err = os.WriteFile(path, pem.EncodeToMemory(block), 0600)
+	if err != nil {
+		logger.Errorf("save honeypot host key error: %s", err.Error())
+	}
+
+	return signer, nil
+}
+
+// startHoneypot 记录并把连接交给蜜罐，返回 false 表示无法交给蜜罐（连接需要由调用者断开）
+func (s *SshServer) startHoneypot(conn net.Conn, headerData []byte, ip net.IP, to string, loc *apiip.QueryIpLocationData, clientVersion string, now time.Time, mark string) bool {
+	cfg := &config.GetConfig().SSH.Honeypot
+
+	signer, err := honeypotHostKey(cfg.HostKey)
+	if err != nil {
+		logger.Errorf("load honeypot host key error: %s", err.Error())
+		_, _ = s.addSshConnectRecord(ip, peerAddress(conn), to, loc, clientVersion, false, now, mark+"蜜罐主机密钥加载失败，直接断开。")
+		return false
+	}
+
+	if honeypotSockets.Add(1) > cfg.MaxSockets {
+		honeypotSockets.Add(-1)
+		_, _ = s.addSshConnectRecord(ip, peerAddress(conn), to, loc, clientVersion, false, now, mark+"蜜罐的连接数已达上限，直接断开。")
+		return false
+	}
+
+	record, err := s.addSshConnectRecord(ip, peerAddress(conn), to, loc, clientVersion, false, now, mark+"连接交给蜜罐（honeypot）。")
+	if err != nil {
+		logger.Errorf("Fail to save ssh connect record to database: %s", err.Error())
+		honeypotSockets.Add(-1)
+		return false // 没有记录无法关联尝试的认证信息
+	}
+
+	s.swg.Add(1)
+	go s.honeypot(newPrefixConn(conn, headerData), ip, clientVersion, record, signer, cfg)
+
+	return true
+}
+
+// honeypot 完成SSH握手，记录客户端尝试的认证信息，认证总是失败
+func (s *SshServer) honeypot(conn net.Conn, ip net.IP, clientVersion string, record *database.SshConnectRecord, signer ssh.Signer, cfg *config.SshHoneypotConfig) {
+	defer s.swg.Done()
+	defer honeypotSockets.Add(-1)
+
+	defer func() {
+		if r := recover(); r != nil {
+			logger.Panicf("forward %s honeypot panic: %v", s.getConfig().Name, r)
+		}
+	}()
+
+	start := time.Now()
+	_ = conn.SetDeadline(start.Add(cfg.MaxDurationDuration))
+
+	var donechan = make(chan bool)
+	defer close(donechan)
+
+	go func() {
+		select {
+		case <-s.stopchan:
+			_ = conn.Close()
+		case <-donechan:
+		}
+	}()
+
+	var attempts int64
+
+	addAttempt := func(meta ssh.ConnMetadata, method string, password *string, key ssh.PublicKey) {
+		attempts++
+
+		attempt := &database.SshHoneypotAttempt{
+			RecordID: record.ID,
+			Forward:  s.getConfig().Name,
+			IP:       ip.String(),
+			ClientVersion: sql.NullString{
+				Valid:  clientVersion != "",
+				String: clientVersion,
+			},
+			User:   meta.User(),
+			Method: method,
+			Time:   time.Now(),
+		}
+
+		if password != nil {
+			attempt.Password = sql.NullString{
+				Valid:  true,
+				String: *password,
+			}
+		}
+
+		if key != nil {
+			attempt.PublicKeyType = sql.NullString{
+				Valid:  true,
+				String: key.Type(),
+			}
+
+			attempt.PublicKeyFingerprint = sql.NullString{
+				Valid:  true,
+				String: ssh.FingerprintSHA256(key),
+			}
+		}
+
+		err := database.AddSshHoneypotAttempt(attempt)
+		if err != nil {
+			logger.Errorf("add ssh honeypot attempt error: %s", err.Error())
+		}
+	}
+
+	sshConfig := &ssh.ServerConfig{
+		ServerVersion: cfg.ServerVersion,
+		MaxAuthTries:  int(cfg.MaxAuthTries),
+		PasswordCallback: func(meta ssh.ConnMetadata, password []byte) (*ssh.Permissions, error) {
+			pw := string(password)
+			addAttempt(meta, "password", &pw, nil)
+			return nil, errHoneypotAuth
+		},
+		PublicKeyCallback: func(meta ssh.ConnMetadata, key ssh.PublicKey) (*ssh.Permissions, error) {
+			addAttempt(meta, "publickey", nil, key)
+			return nil, errHoneypotAuth
+		},
+		KeyboardInteractiveCallback: func(meta ssh.ConnMetadata, challenge ssh.KeyboardInteractiveChallenge) (*ssh.Permissions, error) {
+			answers, err := challenge(meta.User(), "", []string{"Password: "}, []bool{false})
+			if err != nil || len(answers) != 1 {
+				return nil, errHoneypotAuth
+			}
+
+			addAttempt(meta, "keyboard-interactive", &answers[0], nil)
+			return nil, errHoneypotAuth
+		},
+	}
+	sshConfig.AddHostKey(signer)
+
+	sshConn, _, _, err := ssh.NewServerConn(conn, sshConfig)
+	if err == nil {
+		_ = sshConn.Close() // 不会发生：认证总是失败
+	}
+	_ = conn.Close()
+
+	mark := fmt.Sprintf("蜜罐记录 %d 次认证尝试，%s 后断开。", attempts, time.Since(start).Truncate(time.Second).String())
+
+	if cfg.BanAttempts > 0 && attempts >= cfg.BanAttempts {
+		var stop time.Time
+		if cfg.BanDurationDuration > 0 {
+			stop = start.Add(cfg.BanDurationDuration)
+		}
+
+		err = database.AddSshBannedIP(ip.String(), start, stop)
+		if err != nil {
+			logger.Errorf("add ssh banned ip error: %s", err.Error())
+		} else if stop.IsZero() {
+			mark += "IP已被SQLite永久封禁。"
+		} else {
+			mark += fmt.Sprintf("IP已被SQLite封禁至 %s。", stop.Format("2006-01-02 15:04:05"))
+		}
+	}
+
+	err = database.UpdateSshConnectRecord(record, 0, 0, database.DisconnectClient, mark)
+	if err != nil {
+		logger.Errorf("update ssh connect record error: %s", err.Error())
+	}
+}
@@ -0,0 +1,50 @@
+package sshserver
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// TestHoneypotHostKey 加载失败后可以重试，host-key 变化后重新加载
+func TestHoneypotHostKey(t *testing.T) {
+	dir := t.TempDir()
+
+	path := filepath.Join(dir, "host_key")
+	err := os.Mkdir(path, 0700) // 读取目录会失败
+	if err != nil {
+		t.Fatalf("mkdir error: %s", err.Error())
+	}
+
+	_, err = honeypotHostKey(path)
+	if err == nil {
+		t.Fatalf("load host key from a directory should fail")
+	}
+
+	err = os.Remove(path)
+	if err != nil {
+		t.Fatalf("remove error: %s", err.Error())
+	}
+
+	signer, err := honeypotHostKey(path)
+	if err != nil {
+		t.Fatalf("load host key error: %s", err.Error())
+	} else if _, err := os.Stat(path); err != nil {
+		t.Fatalf("host key is not saved: %s", err.Error())
+	}
+
+	again, err := honeypotHostKey(path)
+	if err != nil {
+		t.Fatalf("load host key again error: %s", err.Error())
+	} else if !bytes.Equal(again.PublicKey().Marshal(), signer.PublicKey().Marshal()) {
+		t.Fatalf("host key is not cached")
+	}
+
+	other, err := honeypotHostKey(filepath.Join(dir, "other_host_key"))
+	if err != nil {
+		t.Fatalf("load other host key error: %s", err.Error())
+	} else if bytes.Equal(other.PublicKey().Marshal(), signer.PublicKey().Marshal()) {
+		t.Fatalf("host key is not reloaded after the path changed")
+	}
+}
@@ -0,0 +1,45 @@
+package sshserver
+
+import (
+	"fmt"
+	"net"
+	"strings"
+	"unicode"
+)
+
+const maxIdentificationLength = 255 // RFC 4253 4.2：标识行最长 255 个字符（包括 CR LF）
+
+// readIdentification 读取客户端的标识行（直到 LF，包括行尾），逐字节读取以免读走后续的密钥交换数据。
+// prefix 为已经读取的开头部分（按协议分流时识别协议读取的 SSH-），不包括 LF。
+func readIdentification(conn net.Conn, prefix []byte) ([]byte, error) {
+	res := append(make([]byte, 0, 64), prefix...)
+	buf := make([]byte, 1)
+
+	for len(res) < maxIdentificationLength {
+		n, err := conn.Read(buf)
+		if n == 1 {
+			res = append(res, buf[0])
+			if buf[0] == '\n' {
+				return res, nil
+			}
+		}
+
+		if err != nil {
+			return res, err
+		}
+	}
+
+	return res, fmt.Errorf("标识行超过 %d 字节", maxIdentificationLength)
+}
+
+// identificationString 去掉行尾并替换不可打印的字符，用于记录和规则匹配
+func identificationString(data []byte) string {
+	res := strings.TrimRight(string(data), "\r\n")
+
+	return strings.Map(func(r rune) rune {
+		if r == unicode.ReplacementChar || !unicode.IsPrint(r) {
+			return '?'
+		}
+		return r
+	}, res)
+}
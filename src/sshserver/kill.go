@@ -0,0 +1,80 @@
+package sshserver
+
+import (
+	"fmt"
+	"github.com/SongZihuan/ssh-watcher/src/database"
+	"net"
+	"time"
+)
+
+// SessionInfo 正在进行的会话，用于管理接口
+type SessionInfo struct {
+	ID       uint      `json:"id"` // 连接记录的 ID
+	Forward  string    `json:"forward"`
+	From     string    `json:"from"`
+	Location string    `json:"location"`
+	To       string    `json:"to"`
+	Protocol string    `json:"protocol"` // 按协议分流时识别的协议，未启用时为 ssh
+	Start    time.Time `json:"start"`
+	Upload   int64     `json:"upload"`
+	Download int64     `json:"download"`
+}
+
+func (sess *session) info(forward string) SessionInfo {
+	record := sess.recordCopy()
+
+	res := SessionInfo{
+		ID:       record.ID,
+		Forward:  forward,
+		From:     sess.ip.String(),
+		To:       record.To,
+		Protocol: sess.protocol,
+		Start:    record.Time,
+		Upload:   sess.upload.Load(),
+		Download: sess.download.Load(),
+	}
+
+	if sess.loc != nil {
+		res.Location = sess.loc.String()
+	}
+
+	return res
+}
+
+// Sessions 正在进行的会话，按开始时间排列
+func (s *SshServer) Sessions() []SessionInfo {
+	active := s.activeSessions()
+	forward := s.getConfig().Name
+
+	res := make([]SessionInfo, 0, len(active))
+	for _, sess := range active {
+		res = append(res, sess.info(forward))
+	}
+
+	return res
+}
+
+// Kill 断开连接记录 ID 为 id 的会话，或者来自 ip 的全部会话（id 为 0 时），返回被断开的会话
+func (s *SshServer) Kill(id uint, ip net.IP, note string) []SessionInfo {
+	reason := "会话被管理员断开。"
+	if note != "" {
+		reason = fmt.Sprintf("会话被管理员断开（%s）。", note)
+	}
+
+	forward := s.getConfig().Name
+	res := make([]SessionInfo, 0, 1)
+
+	for _, sess := range s.activeSessions() {
+		if id != 0 && sess.recordCopy().ID != id {
+			continue
+		} else if id == 0 && (ip == nil || !sess.ip.Equal(ip)) {
+			continue
+		}
+
+		if sess.close(database.DisconnectKilled, reason) {
+			res = append(res, sess.info(forward))
+		}
+	}
+
+	return res
+}
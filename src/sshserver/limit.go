@@ -0,0 +1,129 @@
+package sshserver
+
+import (
+	"fmt"
+	"github.com/SongZihuan/ssh-watcher/src/api/apiip"
+	"github.com/SongZihuan/ssh-watcher/src/config"
+	"github.com/SongZihuan/ssh-watcher/src/redisserver"
+	"net"
+	"sync"
+)
+
+type sessionLimitKey struct {
+	ip       string
+	ipv6Net  string // 仅 IPv6 来源有效
+	nation   string
+	province string
+	isp      string
+}
+
+// sessionLimiter 统计每个转发当前的会话数，在回源前预留名额，会话结束后释放
+type sessionLimiter struct {
+	config *config.SshLimitConfig
+
+	lock     sync.Mutex
+	total    int64
+	ip       map[string]int64
+	ipv6Net  map[string]int64
+	nation   map[string]int64
+	province map[string]int64
+	isp      map[string]int64
+}
+
+func newSessionLimiter(cfg *config.SshLimitConfig) *sessionLimiter {
+	return &sessionLimiter{
+		config:   cfg,
+		ip:       make(map[string]int64, 10),
+		ipv6Net:  make(map[string]int64, 10),
+		nation:   make(map[string]int64, 10),
+		province: make(map[string]int64, 10),
+		isp:      make(map[string]int64, 10),
+	}
+}
+
+func newSessionLimitKey(ip net.IP, loc *apiip.QueryIpLocationData) *sessionLimitKey {
+	res := &sessionLimitKey{
+		ip: ip.String(),
+	}
+
+	if ip.To4() == nil {
+		res.ipv6Net = ip.Mask(net.CIDRMask(64, 128)).String()
+	}
+
+	if loc != nil && loc.Isp != redisserver.IspIntranet && loc.Isp != redisserver.IspLoopback { // 内网和本地回环地址不按地区统计
+		res.nation = loc.Nation
+		res.province = loc.Province
+		res.isp = loc.Isp
+	}
+
+	return res
+}
+
+func (l *sessionLimiter) setConfig(cfg *config.SshLimitConfig) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	l.config = cfg
+}
+
+// acquire 检查并预留会话名额，超出限制时返回错误（作为拒绝连接的原因）
+func (l *sessionLimiter) acquire(key *sessionLimitKey) error {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	if l.config.MaxSessions > 0 && l.total >= l.config.MaxSessions {
+		return fmt.Errorf("超出并发会话数限制（转发总数 %d）。", l.config.MaxSessions)
+	}
+
+	if l.config.MaxSessionsPerIP > 0 && l.ip[key.ip] >= l.config.MaxSessionsPerIP {
+		return fmt.Errorf("超出并发会话数限制（单个IP %d）。", l.config.MaxSessionsPerIP)
+	}
+
+	if key.ipv6Net != "" && l.config.MaxSessionsPerIPv6Net > 0 && l.ipv6Net[key.ipv6Net] >= l.config.MaxSessionsPerIPv6Net {
+		return fmt.Errorf("超出并发会话数限制（单个IPv6 /64网段 %d）。", l.config.MaxSessionsPerIPv6Net)
+	}
+
+	if key.nation != "" && l.config.MaxSessionsPerNation > 0 && l.nation[key.nation] >= l.config.MaxSessionsPerNation {
+		return fmt.Errorf("超出并发会话数限制（单个国家 %d）。", l.config.MaxSessionsPerNation)
+	}
+
+	if key.province != "" && l.config.MaxSessionsPerProvince > 0 && l.province[key.province] >= l.config.MaxSessionsPerProvince {
+		return fmt.Errorf("超出并发会话数限制（单个省份 %d）。", l.config.MaxSessionsPerProvince)
+	}
+
+	if key.isp != "" && l.config.MaxSessionsPerISP > 0 && l.isp[key.isp] >= l.config.MaxSessionsPerISP {
+		return fmt.Errorf("超出并发会话数限制（单个ISP %d）。", l.config.MaxSessionsPerISP)
+	}
+
+	l.total++
+	l.ip[key.ip]++
+	addLimitCount(l.ipv6Net, key.ipv6Net, 1)
+	addLimitCount(l.nation, key.nation, 1)
+	addLimitCount(l.province, key.province, 1)
+	addLimitCount(l.isp, key.isp, 1)
+
+	return nil
+}
+
+func (l *sessionLimiter) release(key *sessionLimitKey) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	l.total--
+	addLimitCount(l.ip, key.ip, -1)
+	addLimitCount(l.ipv6Net, key.ipv6Net, -1)
+	addLimitCount(l.nation, key.nation, -1)
+	addLimitCount(l.province, key.province, -1)
+	addLimitCount(l.isp, key.isp, -1)
+}
+
+func addLimitCount(m map[string]int64, key string, n int64) {
+	if key == "" {
+		return
+	}
+
+	m[key] += n
+	if m[key] <= 0 {
+		delete(m, key)
+	}
+}
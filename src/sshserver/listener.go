@@ -0,0 +1,127 @@
+package sshserver
+
+import (
+	"fmt"
+	"github.com/SongZihuan/ssh-watcher/src/ipcheck"
+	"github.com/SongZihuan/ssh-watcher/src/logger"
+	"net"
+	"sync/atomic"
+)
+
+// listener 转发的一个监听地址
+type listener struct {
+	ln      net.Listener
+	network string // tcp4 或 tcp6
+	address string
+	proxy   bool         // 是否接收 Proxy 协议头部（按照 src-proxy 的信任策略处理）
+	pool    *backendPool // 该监听使用的回源地址
+
+	stopped atomic.Bool // accept 循环已退出
+}
+
+// listenPool 按照监听地址的协议选择回源地址，不支持的协议或没有可用的回源地址时返回 nil
+func (s *SshServer) listenPool(network string) (pool *backendPool, srcProxy bool) {
+	cfg := s.getConfig()
+
+	if network == "tcp4" {
+		if !ipcheck.SupportIPv4() {
+			return nil, false
+		} else if s.pool != nil {
+			return s.pool, cfg.IPv4SrcServerProxy.IsEnable(false)
+		} else if s.pool4 != nil {
+			return s.pool4, cfg.IPv4SrcServerProxy.IsEnable(false)
+		} else if cfg.Cross && s.pool6 != nil {
+			return s.pool6, false
+		}
+	} else {
+		if !ipcheck.SupportIPv6() {
+			return nil, false
+		} else if s.pool != nil {
+			return s.pool, cfg.IPv6SrcServerProxy.IsEnable(false)
+		} else if s.pool6 != nil {
+			return s.pool6, cfg.IPv6SrcServerProxy.IsEnable(false)
+		} else if cfg.Cross && s.pool4 != nil {
+			return s.pool4, false
+		}
+	}
+
+	return nil, false
+}
+
+func (s *SshServer) listen(addr *net.TCPAddr) (*listener, error) {
+	network := listenNetwork(addr)
+
+	pool, srcProxy := s.listenPool(network)
+	if pool == nil {
+		return nil, nil
+	}
+
+	ln, err := net.ListenTCP(network, addr)
+	if err != nil {
+		return nil, fmt.Errorf("forward %s listen on %s failed: %s", s.getConfig().Name, addr.String(), err.Error())
+	}
+
+	return newListener(ln, network, pool, srcProxy), nil
+}
+
+// adopt 使用外部传入的监听（例如 systemd 套接字激活），而不是按照配置自行监听
+func (s *SshServer) adopt(ln net.Listener) (*listener, error) {
+	addr, ok := ln.Addr().(*net.TCPAddr)
+	if !ok {
+		return nil, fmt.Errorf("forward %s inherited listener %s is not a tcp listener", s.getConfig().Name, ln.Addr().String())
+	}
+
+	network := listenNetwork(addr)
+
+	pool, srcProxy := s.listenPool(network)
+	if pool == nil {
+		return nil, fmt.Errorf("forward %s has no dest address for inherited listener %s", s.getConfig().Name, addr.String())
+	}
+
+	return newListener(ln, network, pool, srcProxy), nil
+}
+
+func newListener(ln net.Listener, network string, pool *backendPool, srcProxy bool) *listener {
+	return &listener{
+		ln:      ln,
+		network: network,
+		address: ln.Addr().String(),
+		proxy:   srcProxy,
+		pool:    pool,
+	}
+}
+
+func listenNetwork(addr *net.TCPAddr) string {
+	if addr.IP.To4() != nil {
+		return "tcp4"
+	}
+
+	return "tcp6"
+}
+
+func (s *SshServer) serve(l *listener) {
+	defer s.lwg.Done()
+	defer l.stopped.Store(true)
+
+	defer func() {
+		_ = l.ln.Close()
+	}()
+
+	logger.Infof("forward %s listen on %s start", s.getConfig().Name, l.address)
+MainCycle:
+	for {
+		select {
+		case <-s.stopchan:
+			break MainCycle
+		default:
+			// pass
+		}
+
+		status := s.accept(l)
+		if status == StatusStop {
+			break MainCycle
+		}
+	}
+
+	logger.Infof("forward %s listen on %s stop", s.getConfig().Name, l.address)
+}
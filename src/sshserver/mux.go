@@ -0,0 +1,239 @@
+package sshserver
+
+import (
+	"errors"
+	"fmt"
+	"github.com/SongZihuan/ssh-watcher/src/config"
+	"golang.org/x/crypto/cryptobyte"
+	"io"
+	"net"
+	"strings"
+)
+
+const (
+	maxTLSRecordLength   = 16384 + 2048 // RFC 8446 5.2：TLSCiphertext 的最大长度，ClientHello 不会超过
+	maxClientHelloLength = 64 * 1024    // ClientHello 可能跨越多个记录，最多读取的长度
+	maxHTTPMethodLength  = 8            // 最长的 HTTP 方法（OPTIONS、CONNECT）加空格
+)
+
+var httpMethods = []string{"GET", "HEAD", "POST", "PUT", "DELETE", "CONNECT", "OPTIONS", "TRACE", "PATCH", "PRI"} // PRI 为 HTTP/2 的连接前言
+
+// newMuxPools 为按协议分流的每个转发目标创建回源地址，序号与 mux.routes 相同
+func newMuxPools(cfg *config.SshForwardConfig) []*backendPool {
+	if !cfg.Mux.IsEnable() {
+		return nil
+	}
+
+	res := make([]*backendPool, 0, len(cfg.Mux.Routes))
+	for _, r := range cfg.Mux.Routes {
+		if r.Backend.ResolveUnixAddress != nil {
+			res = append(res, newSingleBackendPool(cfg.Name, r.Backend.ResolveUnixAddress, r.Backend.Network))
+		} else {
+			res = append(res, newSingleBackendPool(cfg.Name, r.Backend.ResolveAddress, r.Backend.Network))
+		}
+	}
+
+	return res
+}
+
+// muxMark 按协议分流的连接记录备注
+func muxMark(protocol string, sni string) string {
+	switch protocol {
+	case config.MuxProtocolSSH:
+		return "按协议分流：SSH。"
+	case config.MuxProtocolTLS:
+		if sni == "" {
+			return "按协议分流：TLS（无 SNI）。"
+		}
+		return fmt.Sprintf("按协议分流：TLS（SNI %s）。", identificationString([]byte(sni)))
+	case config.MuxProtocolHTTP:
+		return "按协议分流：HTTP。"
+	default:
+		return "按协议分流：无法识别的协议。"
+	}
+}
+
+// sniffReader 记录识别协议时读取的全部数据，转发时需要先原样写入回源地址
+type sniffReader struct {
+	conn net.Conn
+	data []byte
+}
+
+// next 读取 n 个字节，出错时已读取的部分仍然保留在 data 中
+func (r *sniffReader) next(n int) ([]byte, error) {
+	start := len(r.data)
+	r.data = append(r.data, make([]byte, n)...)
+
+	m, err := io.ReadFull(r.conn, r.data[start:])
+	r.data = r.data[:start+m]
+
+	return r.data[start:], err
+}
+
+// sniff 读取连接开头的数据判断协议（ssh、tls、http 或 other），返回已读取的数据，tls 时同时返回 ClientHello 中的服务器名称（小写）。
+// 读取超时（例如客户端等待服务器先发送数据）或者数据无法识别时为 other；客户端断开等其他错误时返回错误。
+func sniff(conn net.Conn) (protocol string, sni string, data []byte, err error) {
+	r := &sniffReader{conn: conn}
+
+	protocol, sni, err = r.sniff()
+	if err != nil {
+		var netErr net.Error
+		if errors.As(err, &netErr) && netErr.Timeout() {
+			return config.MuxProtocolOther, "", r.data, nil
+		}
+
+		return "", "", r.data, err
+	}
+
+	return protocol, sni, r.data, nil
+}
+
+func (r *sniffReader) sniff() (string, string, error) {
+	first, err := r.next(1)
+	if err != nil {
+		return "", "", err
+	}
+
+	switch {
+	case first[0] == 'S': // 没有以 S 开头的 HTTP 方法
+		rest, err := r.next(3)
+		if err != nil {
+			return "", "", err
+		} else if string(rest) != "SH-" {
+			return config.MuxProtocolOther, "", nil
+		}
+
+		return config.MuxProtocolSSH, "", nil
+	case first[0] == 0x16: // TLS 记录：握手
+		sni, ok, err := r.clientHello()
+		if err != nil {
+			return "", "", err
+		} else if !ok {
+			return config.MuxProtocolOther, "", nil
+		}
+
+		return config.MuxProtocolTLS, sni, nil
+	case first[0] >= 'A' && first[0] <= 'Z':
+		method := []byte{first[0]}
+		for len(method) < maxHTTPMethodLength {
+			b, err := r.next(1)
+			if err != nil {
+				return "", "", err
+			} else if b[0] == ' ' {
+				break
+			}
+
+			method = append(method, b[0])
+		}
+
+		for _, m := range httpMethods {
+			if string(method) == m {
+				return config.MuxProtocolHTTP, "", nil
+			}
+		}
+
+		return config.MuxProtocolOther, "", nil
+	default:
+		return config.MuxProtocolOther, "", nil
+	}
+}
+
+// clientHello 读取（可能跨越多个记录的）ClientHello 并取出服务器名称，不是有效的 ClientHello 时 ok 为 false
+func (r *sniffReader) clientHello() (sni string, ok bool, err error) {
+	handshake := make([]byte, 0, 512)
+
+	for first := true; ; first = false {
+		var header []byte
+		if first { // 第一个字节（记录类型）已读取
+			header, err = r.next(4)
+			if err != nil {
+				return "", false, err
+			}
+		} else {
+			header, err = r.next(5)
+			if err != nil {
+				return "", false, err
+			} else if header[0] != 0x16 {
+				return "", false, nil
+			}
+			header = header[1:]
+		}
+
+		length := int(header[2])<<8 | int(header[3])
+		if header[0] != 0x03 || length == 0 || length > maxTLSRecordLength || len(handshake)+length > maxClientHelloLength {
+			return "", false, nil
+		}
+
+		payload, err := r.next(length)
+		if err != nil {
+			return "", false, err
+		}
+
+		handshake = append(handshake, payload...)
+		if len(handshake) < 4 {
+			continue
+		} else if handshake[0] != 0x01 { // 握手消息类型：ClientHello
+			return "", false, nil
+		}
+
+		msgLength := int(handshake[1])<<16 | int(handshake[2])<<8 | int(handshake[3])
+		if 4+msgLength > maxClientHelloLength {
+			return "", false, nil
+		} else if len(handshake) < 4+msgLength {
+			continue
+		}
+
+		sni, ok = parseClientHelloSNI(handshake[4 : 4+msgLength])
+		return sni, ok, nil
+	}
+}
+
+// parseClientHelloSNI 从 ClientHello 的消息体中取出 server_name 扩展的主机名（RFC 6066 3），没有时返回空字符串
+func parseClientHelloSNI(body []byte) (string, bool) {
+	s := cryptobyte.String(body)
+
+	var sessionID, cipherSuites, compression, extensions cryptobyte.String
+	if !s.Skip(2+32) || // 版本和随机数
+		!s.ReadUint8LengthPrefixed(&sessionID) ||
+		!s.ReadUint16LengthPrefixed(&cipherSuites) ||
+		!s.ReadUint8LengthPrefixed(&compression) {
+		return "", false
+	}
+
+	if s.Empty() { // 没有扩展
+		return "", true
+	} else if !s.ReadUint16LengthPrefixed(&extensions) {
+		return "", false
+	}
+
+	for !extensions.Empty() {
+		var extType uint16
+		var ext cryptobyte.String
+		if !extensions.ReadUint16(&extType) || !extensions.ReadUint16LengthPrefixed(&ext) {
+			return "", false
+		}
+
+		if extType != 0 { // server_name
+			continue
+		}
+
+		var names cryptobyte.String
+		if !ext.ReadUint16LengthPrefixed(&names) {
+			return "", false
+		}
+
+		for !names.Empty() {
+			var nameType uint8
+			var name cryptobyte.String
+			if !names.ReadUint8(&nameType) || !names.ReadUint16LengthPrefixed(&name) {
+				return "", false
+			}
+
+			if nameType == 0 { // host_name
+				return strings.ToLower(strings.TrimSuffix(string(name), ".")), true
+			}
+		}
+	}
+
+	return "", true
+}
@@ -0,0 +1,31 @@
+package sshserver
+
+import (
+	"net"
+	"strings"
+	"time"
+)
+
+// preBanner 将提示信息转换为SSH标识行之前的文本行（RFC 4253 4.2），每行以 CRLF 结尾
+func preBanner(message string) []byte {
+	message = strings.TrimRight(message, "\r\n")
+
+	res := make([]byte, 0, len(message)+16)
+	for _, line := range strings.Split(message, "\n") {
+		res = append(res, strings.TrimSuffix(line, "\r")...)
+		res = append(res, '\r', '\n')
+	}
+
+	return res
+}
+
+// sendPreBanner 在断开连接前向客户端发送提示信息，最多等待5秒
+func sendPreBanner(conn net.Conn, message string) error {
+	err := conn.SetWriteDeadline(time.Now().Add(5 * time.Second))
+	if err != nil {
+		return err
+	}
+
+	_, err = conn.Write(preBanner(message))
+	return err
+}
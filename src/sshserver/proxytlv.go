@@ -0,0 +1,92 @@
+package sshserver
+
+import (
+	"fmt"
+	"github.com/SongZihuan/ssh-watcher/src/config"
+	"github.com/SongZihuan/ssh-watcher/src/database"
+	"github.com/SongZihuan/ssh-watcher/src/logger"
+	"github.com/pires/go-proxyproto"
+	"net"
+	"strconv"
+)
+
+// 附加到回源 Proxy 协议 v2 头部的自定义 TLV 类型（PP2_TYPE_MIN_CUSTOM 到 PP2_TYPE_MAX_CUSTOM），值均为 UTF-8 字符串。
+// 连接的唯一 ID 使用标准的 PP2_TYPE_UNIQUE_ID（0x05）。
+const (
+	tlvTypeRecordID = proxyproto.PP2_TYPE_MIN_CUSTOM + iota // 0xE0 连接记录的 ID（十进制）
+	tlvTypeNation                                           // 0xE1 国家
+	tlvTypeProvince                                         // 0xE2 省份
+	tlvTypeCity                                             // 0xE3 城市
+	tlvTypeISP                                              // 0xE4 服务商（ISP）
+	tlvTypeRule                                             // 0xE5 命中的规则（序号和匹配条件），未命中规则时不附加
+)
+
+// destProxyTLVs 按照 dest-proxy-tlv 的设定生成回源 Proxy 协议头部的 TLV：附加本次连接的判定信息，并透传来访连接的 TLV
+func (s *SshServer) destProxyTLVs(conn net.Conn, record *database.SshConnectRecord, rule *config.SshRuleConfig) []proxyproto.TLV {
+	cfg := s.getConfig()
+	res := make([]proxyproto.TLV, 0, 8)
+
+	context := cfg.DestProxyTLV.Context.IsEnable(false)
+	if context {
+		res = appendTLV(res, proxyproto.PP2_TYPE_UNIQUE_ID, record.UniqueID)
+		res = appendTLV(res, tlvTypeRecordID, strconv.FormatUint(uint64(record.ID), 10))
+		res = appendTLV(res, tlvTypeNation, record.Nation.String)
+		res = appendTLV(res, tlvTypeProvince, record.Province.String)
+		res = appendTLV(res, tlvTypeCity, record.City.String)
+		res = appendTLV(res, tlvTypeISP, record.ISP.String)
+		if rule != nil {
+			res = appendTLV(res, tlvTypeRule, ruleName(cfg, rule))
+		}
+	}
+
+	if cfg.DestProxyTLV.Passthrough.IsEnable(false) {
+		pconn, ok := conn.(*proxyproto.Conn)
+		if !ok || pconn.ProxyHeader() == nil {
+			return res
+		}
+
+		incoming, err := pconn.ProxyHeader().TLVs()
+		if err != nil {
+			logger.Warnf("forward %s read tlv from proxy header error: %s", cfg.Name, err.Error())
+			return res
+		}
+
+		for _, t := range incoming {
+			if t.Type == proxyproto.PP2_TYPE_CRC32C || t.Type == proxyproto.PP2_TYPE_NOOP { // 校验和需要重新计算，填充无需透传
+				continue
+			} else if context && isContextTLV(t.Type) { // 附加判定信息时，同类型的 TLV 以本程序为准（即使本程序没有附加，例如没有命中规则）
+				continue
+			}
+
+			res = append(res, t)
+		}
+	}
+
+	return res
+}
+
+func appendTLV(tlvs []proxyproto.TLV, t proxyproto.PP2Type, value string) []proxyproto.TLV {
+	if value == "" {
+		return tlvs
+	}
+
+	return append(tlvs, proxyproto.TLV{
+		Type:  t,
+		Value: []byte(value),
+	})
+}
+
+func isContextTLV(t proxyproto.PP2Type) bool {
+	return t == proxyproto.PP2_TYPE_UNIQUE_ID || (t >= tlvTypeRecordID && t <= tlvTypeRule)
+}
+
+// ruleName 规则在规则列表中的序号（从 1 开始）和匹配条件
+func ruleName(cfg *config.SshForwardConfig, rule *config.SshRuleConfig) string {
+	for i, r := range cfg.ResolveRuleList.RuleList {
+		if r == rule {
+			return fmt.Sprintf("#%d %s", i+1, rule.String())
+		}
+	}
+
+	return rule.String()
+}
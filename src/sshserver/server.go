@@ -1,220 +1,172 @@
 package sshserver
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"github.com/SongZihuan/ssh-watcher/src/api/apiip"
 	"github.com/SongZihuan/ssh-watcher/src/config"
 	"github.com/SongZihuan/ssh-watcher/src/database"
-	"github.com/SongZihuan/ssh-watcher/src/ipcheck"
 	"github.com/SongZihuan/ssh-watcher/src/logger"
 	"github.com/SongZihuan/ssh-watcher/src/notify"
 	"github.com/SongZihuan/ssh-watcher/src/redisserver"
 	"github.com/pires/go-proxyproto"
-	"io"
 	"net"
+	"sort"
 	"strings"
 	"sync"
 	"sync/atomic"
+	"syscall"
 	"time"
 )
 
 type SshServer struct {
 	status atomic.Int32
-	config *config.SshForwardConfig
+	config atomic.Pointer[config.SshForwardConfig] // 重载配置时原子地替换
 
-	ln4              net.Listener
-	ln4Proxy         bool
-	ln4Cross         bool
-	ln4Target        *net.TCPAddr
-	ln4TargetNetwork string
+	pool  *backendPool // 配置了 backends 时使用
+	pool4 *backendPool // 未配置 backends 时，ipv4 回源地址
+	pool6 *backendPool // 未配置 backends 时，ipv6 回源地址
 
-	ln6              net.Listener
-	ln6Proxy         bool
-	ln6Cross         bool
-	ln6Target        *net.TCPAddr
-	ln6TargetNetwork string
+	muxPools []*backendPool // 按协议分流的转发目标，序号与 mux.routes 相同
 
-	swg      sync.WaitGroup
+	listeners []*listener
+	inherited []net.Listener // 外部传入的监听（例如 systemd 套接字激活），启动时代替自行监听
+
+	limiter   *sessionLimiter
+	bandwidth *rateLimiterGroup
+	connRate  *connRateLimiter
+	banKick   chan bool // 立即检查已建立的会话的来源是否被封禁
+
+	queue       chan *pendingConn // 等待检查的连接
+	workers     []*acceptWorker
+	acceptStats *acceptStats
+
+	lwg      sync.WaitGroup // 监听（accept 循环）
+	wwg      sync.WaitGroup // 检查新连接的工作协程
+	swg      sync.WaitGroup // 会话、tarpit 和蜜罐
 	allconn  sync.Map
 	stopchan chan bool
 }
 
 func NewSshServer(cfg *config.SshForwardConfig) (*SshServer, error) {
-	if cfg.ResolveIPv4DestAddress == nil && cfg.ResolveIPv6DestAddress == nil {
+	if len(cfg.Backends) == 0 && cfg.ResolveUnixDestAddress == nil && cfg.ResolveIPv4DestAddress == nil && cfg.ResolveIPv6DestAddress == nil {
 		return nil, fmt.Errorf("no dest address")
 	}
 
 	res := &SshServer{
-		config: cfg,
+		limiter:     newSessionLimiter(&cfg.Limit),
+		bandwidth:   newRateLimiterGroup(),
+		connRate:    newConnRateLimiter(&cfg.RateLimit),
+		banKick:     make(chan bool, 1),
+		acceptStats: newAcceptStats(),
 	}
 
+	res.config.Store(cfg)
+
+	if len(cfg.Backends) > 0 {
+		res.pool = newBackendPool(cfg)
+	} else if cfg.ResolveUnixDestAddress != nil {
+		res.pool = newSingleBackendPool(cfg.Name, cfg.ResolveUnixDestAddress, "unix") // ipv4 和 ipv6 的监听都转发到 Unix 套接字
+	} else {
+		if cfg.ResolveIPv4DestAddress != nil {
+			res.pool4 = newSingleBackendPool(cfg.Name, cfg.ResolveIPv4DestAddress, "tcp4")
+		}
+
+		if cfg.ResolveIPv6DestAddress != nil {
+			res.pool6 = newSingleBackendPool(cfg.Name, cfg.ResolveIPv6DestAddress, "tcp6")
+		}
+	}
+
+	res.muxPools = newMuxPools(cfg)
+
 	res.status.Store(StatusReady)
 
 	return res, nil
 }
 
+func (s *SshServer) getConfig() *config.SshForwardConfig {
+	return s.config.Load()
+}
+
+// setConfig 重载时替换规则等配置，已有的会话不受影响
+func (s *SshServer) setConfig(cfg *config.SshForwardConfig) {
+	s.config.Store(cfg)
+	s.limiter.setConfig(&cfg.Limit)
+	s.connRate.setConfig(&cfg.RateLimit)
+	s.kickBanWatch() // 新的规则可能封禁了已建立的会话的来源
+}
+
 func (s *SshServer) Start() (err error) {
-	if s.ln4 != nil || s.status.Load() != StatusReady {
+	if len(s.listeners) != 0 || s.status.Load() != StatusReady {
 		return nil
 	}
 
-	if ipcheck.SupportIPv4() {
-		if s.config.ResolveIPv4DestAddress != nil {
-			_ln4, err := net.ListenTCP("tcp4", s.config.ResolveIPv4SrcAddress)
-			if err != nil {
-				return fmt.Errorf("listen %d on tcp4 failed: %s", s.config.SrcPort, err.Error())
-			}
+	listeners := make([]*listener, 0, len(s.getConfig().ResolveListenAddresses))
+	if len(s.inherited) > 0 {
+		inherited := s.inherited
+		s.inherited = nil
 
-			if s.config.IPv4SrcServerProxy.IsEnable(false) {
-				s.ln4 = &proxyproto.Listener{
-					Listener: _ln4,
-				}
-				s.ln4Proxy = true
-				s.ln4Cross = false
-				s.ln4Target = s.config.ResolveIPv4DestAddress
-				s.ln4TargetNetwork = "tcp4"
-			} else {
-				s.ln4 = _ln4
-				s.ln4Proxy = false
-				s.ln4Cross = false
-				s.ln4Target = s.config.ResolveIPv4DestAddress
-				s.ln4TargetNetwork = "tcp4"
-			}
-		} else if s.config.Cross && s.config.ResolveIPv6DestAddress != nil {
-			_ln4, err := net.ListenTCP("tcp4", s.config.ResolveIPv4SrcAddress)
+		for i, ln := range inherited {
+			l, err := s.adopt(ln)
 			if err != nil {
-				return fmt.Errorf("listen %d on tcp4 failed: %s", s.config.SrcPort, err.Error())
+				for _, opened := range listeners {
+					_ = opened.ln.Close()
+				}
+				for _, rest := range inherited[i:] {
+					_ = rest.Close()
+				}
+				return err
 			}
 
-			s.ln4 = _ln4
-			s.ln4Proxy = false
-			s.ln4Cross = true
-			s.ln4Target = s.config.ResolveIPv6DestAddress
-			s.ln4TargetNetwork = "tcp6"
+			listeners = append(listeners, l)
 		}
 	} else {
-		s.ln4 = nil
-		s.ln4Proxy = false
-		s.ln4Cross = false
-		s.ln4Target = nil
-		s.ln4TargetNetwork = ""
-	}
-
-	if ipcheck.SupportIPv6() {
-		if s.config.ResolveIPv6DestAddress != nil {
-			_ln6, err := net.ListenTCP("tcp6", s.config.ResolveIPv6SrcAddress)
+		for _, addr := range s.getConfig().ResolveListenAddresses {
+			l, err := s.listen(addr)
 			if err != nil {
-				return fmt.Errorf("listen %d on tcp6 failed: %s", s.config.SrcPort, err.Error())
-			}
-
-			if s.config.IPv6SrcServerProxy.IsEnable(false) {
-				s.ln6 = &proxyproto.Listener{
-					Listener: _ln6,
+				for _, opened := range listeners {
+					_ = opened.ln.Close()
 				}
-				s.ln6Proxy = true
-				s.ln6Cross = false
-				s.ln6Target = s.config.ResolveIPv6DestAddress
-				s.ln6TargetNetwork = "tcp6"
-			} else {
-				s.ln6 = _ln6
-				s.ln6Proxy = false
-				s.ln6Cross = false
-				s.ln6Target = s.config.ResolveIPv6DestAddress
-				s.ln6TargetNetwork = "tcp6"
-			}
-		} else if s.config.Cross && s.config.ResolveIPv4DestAddress != nil {
-			_ln6, err := net.ListenTCP("tcp6", s.config.ResolveIPv6SrcAddress)
-			if err != nil {
-				return fmt.Errorf("listen %d on tcp6 failed: %s", s.config.SrcPort, err.Error())
+				return err
+			} else if l == nil {
+				continue // 不支持该协议或该协议没有可用的回源地址
 			}
 
-			s.ln6 = _ln6
-			s.ln6Proxy = false
-			s.ln6Cross = true
-			s.ln6Target = s.config.ResolveIPv4DestAddress
-			s.ln6TargetNetwork = "tcp4"
+			listeners = append(listeners, l)
 		}
-	} else {
-		s.ln6 = nil
-		s.ln6Proxy = false
-		s.ln6Cross = false
-		s.ln6Target = nil
-		s.ln6TargetNetwork = ""
 	}
 
-	if s.ln4 == nil && s.ln6 == nil {
+	if len(listeners) == 0 {
 		return fmt.Errorf("no listen address")
 	}
 
-	if s.ln4Target == nil && s.ln6Target == nil {
-		return fmt.Errorf("no target address")
-	}
-
+	s.listeners = listeners
 	s.stopchan = make(chan bool, 4)
+	s.queue = make(chan *pendingConn, s.getConfig().Accept.Queue)
 
-	if s.ln4 != nil {
-		go func() {
-			defer func() {
-				_ = s.ln4.Close()
-				s.ln4 = nil
-			}()
-
-			logger.Infof("listen on %d (ipv4) start", s.config.SrcPort)
-		MainCycle:
-			for {
-				select {
-				case <-s.stopchan:
-					break MainCycle
-				default:
-					// pass
-				}
+	if s.pool != nil {
+		s.pool.start()
+	}
 
-				status := s.accept(s.ln4,
-					"tcp4",
-					!s.ln4Cross && s.config.IPv4DestRequestProxy.IsEnable(true),
-					s.config.IPv4DestRequestProxyVersion,
-					s.ln4TargetNetwork,
-					s.ln4Target)
-				if status == StatusStop {
-					break MainCycle
-				}
-			}
+	s.workers = make([]*acceptWorker, 0, s.getConfig().Accept.Workers)
+	for i := int64(0); i < s.getConfig().Accept.Workers; i++ {
+		w := &acceptWorker{}
+		s.workers = append(s.workers, w)
 
-			logger.Infof("listen on %d (ipv4) stop", s.config.SrcPort)
-		}()
+		s.wwg.Add(1)
+		go s.work(w)
 	}
 
-	if s.ln6 != nil {
-		go func() {
-			defer func() {
-				_ = s.ln6.Close()
-				s.ln6 = nil
-			}()
-
-			logger.Infof("listen on %d (ipv6) start", s.config.SrcPort)
-		MainCycle:
-			for {
-				select {
-				case <-s.stopchan:
-					break MainCycle
-				default:
-					// pass
-				}
+	for _, l := range s.listeners {
+		s.lwg.Add(1)
+		go s.serve(l)
+	}
 
-				status := s.accept(s.ln6,
-					"tcp6",
-					!s.ln6Cross && s.config.IPv6DestRequestProxy.IsEnable(true),
-					s.config.IPv6DestRequestProxyVersion,
-					s.ln6TargetNetwork,
-					s.ln6Target)
-				if status == StatusStop {
-					break MainCycle
-				}
-			}
+	s.lwg.Add(1)
+	go s.rateLimitCycle()
 
-			logger.Infof("listen on %d (ipv6) stop", s.config.SrcPort)
-		}()
-	}
+	go s.banWatchCycle() // 停止监听后仍需检查等待结束的会话，不计入 lwg
 
 	if !s.status.CompareAndSwap(StatusReady, StatusRunning) {
 		return fmt.Errorf("server run failed: can not set status")
@@ -224,47 +176,197 @@ func (s *SshServer) Start() (err error) {
 }
 
 func (s *SshServer) Stop() error {
-	if s.ln4 == nil || !s.status.CompareAndSwap(StatusRunning, StatusStopping) {
-		return nil
+	return s.StopWithin(s.getConfig().DrainTimeoutDuration)
+}
+
+// StopWithin 与 Stop 相同，但使用指定的等待会话结束的时长，小于 0 表示一直等待
+func (s *SshServer) StopWithin(drain time.Duration) error {
+	if drain < 0 {
+		return s.Shutdown(context.Background())
 	}
 
-	close(s.stopchan)
+	ctx, cancel := context.WithTimeout(context.Background(), drain)
+	defer cancel()
 
-	time.Sleep(1 * time.Second)
+	return s.Shutdown(ctx)
+}
+
+// Shutdown 立即关闭监听，等待会话结束，ctx 结束时强制断开剩余的会话
+func (s *SshServer) Shutdown(ctx context.Context) error {
+	if s.status.CompareAndSwap(StatusRunning, StatusStopping) {
+		s.closeListeners()
+	} else if !s.status.CompareAndSwap(StatusRetired, StatusStopping) { // 已退役的转发监听已关闭，只需等待会话
+		return nil
+	}
 
+	var donechan = make(chan bool)
 	go func() {
-		time.Sleep(time.Second * 10)
+		defer close(donechan)
+		s.swg.Wait()
+	}()
 
-		s.allconn.Range(func(key, value any) bool {
-			conn, ok := value.(net.Conn)
-			if !ok {
-				return true
-			}
+	active := s.activeSessions()
+	if len(active) > 0 {
+		desc := make([]string, 0, len(active))
+		for _, sess := range active {
+			desc = append(desc, sess.String())
+		}
 
-			go func() {
-				_ = conn.Close()
-			}()
-			return true
-		})
-		s.allconn.Clear()
-	}()
+		deadline, ok := ctx.Deadline()
+		drain := time.Duration(0)
+		if ok {
+			drain = time.Until(deadline).Round(time.Second)
+		}
 
-	s.swg.Wait()
+		logger.Infof("forward %s is stopping, wait for %d sessions: %s", s.getConfig().Name, len(active), strings.Join(desc, "; "))
+		notify.SendSshDrain(s.getConfig().Name, drain, desc)
+	}
+
+	select {
+	case <-donechan:
+		// pass
+	case <-ctx.Done():
+		reason := "服务停止，等待会话结束超时，连接被强制断开。"
+		if errors.Is(ctx.Err(), context.Canceled) {
+			reason = "服务停止，等待会话结束时再次收到退出信号，连接被强制断开。"
+		}
+
+		for _, sess := range s.activeSessions() {
+			sess.close(database.DisconnectShutdown, reason)
+		}
+		<-donechan
+	}
+
+	if s.pool != nil {
+		s.pool.stop()
+	}
 
 	s.status.CompareAndSwap(StatusStopping, StatusFinished)
 	return nil
 }
 
-func (s *SshServer) forward(remoteAddr string, conn net.Conn, target net.Conn, record *database.SshConnectRecord) {
+// Retire 关闭监听和健康检查，但不断开已有的会话，用于重载配置时替换转发
+func (s *SshServer) Retire() {
+	if !s.status.CompareAndSwap(StatusRunning, StatusRetired) {
+		return
+	}
+
+	s.closeListeners()
+
+	if s.pool != nil {
+		s.pool.stop()
+	}
+
+	go func() {
+		s.swg.Wait()
+		s.status.CompareAndSwap(StatusRetired, StatusFinished)
+	}()
+}
+
+// Listeners 正在使用的监听，未运行时返回 nil
+func (s *SshServer) Listeners() []net.Listener {
+	if s.status.Load() != StatusRunning {
+		return nil
+	}
+
+	res := make([]net.Listener, 0, len(s.listeners))
+	for _, l := range s.listeners {
+		res = append(res, l.ln)
+	}
+
+	return res
+}
+
+// Healthy 检查是否还能接受新连接：监听意外退出，或者所有工作协程检查各自的连接都超过 maxBusy
+func (s *SshServer) Healthy(maxBusy time.Duration) error {
+	if s.status.Load() != StatusRunning {
+		return nil
+	}
+
+	for _, l := range s.listeners {
+		if l.stopped.Load() {
+			return fmt.Errorf("forward %s listen on %s stopped", s.getConfig().Name, l.address)
+		}
+	}
+
+	var least time.Duration = -1
+	for _, w := range s.workers {
+		busy := w.busy()
+		if least < 0 || busy < least {
+			least = busy
+		}
+	}
+
+	if least > maxBusy {
+		return fmt.Errorf("forward %s all %d accept workers are busy for more than %s", s.getConfig().Name, len(s.workers), least.Round(time.Millisecond))
+	}
+
+	return nil
+}
+
+// IsFinished 监听已关闭且所有会话都已结束
+func (s *SshServer) IsFinished() bool {
+	return s.status.Load() == StatusFinished
+}
+
+func (s *SshServer) closeListeners() {
+	close(s.stopchan) // tarpit 和蜜罐的连接会立即断开
+
+	for _, l := range s.listeners {
+		_ = l.ln.Close()
+	}
+
+	s.lwg.Wait()
+	s.wwg.Wait() // 等待正在处理的连接完成检查，此后不会再有新的会话
+	s.drainQueue()
+	s.rateLimitSummary()
+}
+
+func (s *SshServer) activeSessions() []*session {
+	res := make([]*session, 0, 10)
+
+	s.allconn.Range(func(key, value any) bool {
+		sess, ok := value.(*session)
+		if ok {
+			res = append(res, sess)
+		}
+		return true
+	})
+
+	sort.Slice(res, func(i, j int) bool {
+		return res[i].recordCopy().Time.Before(res[j].recordCopy().Time)
+	})
+
+	return res
+}
+
+func (s *SshServer) forward(sess *session, tap func(p []byte)) {
+	conn := sess.conn
+	target := sess.target
+
+	defer s.limiter.release(sess.limitKey)
+	defer sess.bandwidth.release()
+
 	defer func() {
 		defer func() {
 			_ = recover()
 		}()
 
-		err := database.UpdateSshConnectRecord(record, "连接正常断开。")
+		cause, reason := sess.closeReason()
+		if alert := sess.banAlert.Load(); alert != nil {
+			reason = *alert + reason
+		}
+
+		err := sess.updateRecord(func(record *database.SshConnectRecord) error {
+			return database.UpdateSshConnectRecord(record, sess.upload.Load(), sess.download.Load(), cause, reason)
+		})
 		if err != nil {
-			logger.Errorf("update ssh connect record error: %s", record)
+			logger.Errorf("update ssh connect record error: %s", err.Error())
 		}
+
+		record := sess.recordCopy()
+		notify.SendSshDisconnect(s.getConfig().Name, record.From, sess.loc, record.To, record.Mark,
+			record.TimeConsuming.Int64, sess.upload.Load(), sess.download.Load())
 	}()
 
 	defer func() {
@@ -278,19 +380,25 @@ func (s *SshServer) forward(remoteAddr string, conn net.Conn, target net.Conn, r
 		}
 	}()
 
-	s.swg.Add(1)
 	defer s.swg.Done()
 
-	if _, loaded := s.allconn.LoadOrStore(remoteAddr, conn); loaded {
-		logger.Errorf("%s is already connected", remoteAddr)
+	sess.backend.conns.Add(1)
+	defer sess.backend.conns.Add(-1)
+
+	if _, loaded := s.allconn.LoadOrStore(sess.remoteAddr, sess); loaded {
+		logger.Errorf("%s is already connected", sess.remoteAddr)
 		return
 	}
 	defer func() {
-		s.allconn.Delete(remoteAddr)
+		s.allconn.Delete(sess.remoteAddr)
 	}()
 
-	var stopchan1 = make(chan bool)
-	var stopchan2 = make(chan bool)
+	if sess.isClosed() {
+		return // 转发开始前已被断开（例如 hold 期间客户端发送的指纹检查不通过），只保存连接记录
+	}
+
+	// 每个方向结束时发送是否已向另一端传递了半关闭（收到 EOF 并成功 CloseWrite）
+	var halfClosed = make(chan bool, 2)
 
 	var wg sync.WaitGroup
 
@@ -317,9 +425,8 @@ func (s *SshServer) forward(remoteAddr string, conn net.Conn, target net.Conn, r
 		_ = _target.Close()
 	}()
 
+	wg.Add(1)
 	go func() {
-		wg.Add(1)
-
 		defer wg.Done()
 
 		//defer func() {
@@ -332,11 +439,21 @@ func (s *SshServer) forward(remoteAddr string, conn net.Conn, target net.Conn, r
 		//	}
 		//}()
 
-		defer func() {
-			close(stopchan1)
-		}()
+		_, err := sess.copy(target, conn, &sess.upload, sess.bandwidth.upload, tap)
+		if err == nil && !sess.isFinished() {
+			sess.end(database.DisconnectClient, "客户端断开连接。")
+			halfClosed <- closeWrite(target) == nil // 失败时（例如对端已经断开）直接结束整个会话
+			return
+		}
+
+		halfClosed <- false
+
+		if err != nil && (sess.isClosed() || sess.isFinished()) {
+			return // 主动断开，不记录错误
+		} else if err != nil {
+			sess.end(database.DisconnectError, fmt.Sprintf("转发出错（客户端 -> 回源地址）：%s。", err.Error()))
+		}
 
-		_, err := io.Copy(target, conn)
 		if err != nil && conn != nil && target != nil && s.status.Load() == StatusRunning {
 			logger.Errorf("failed to forward from conn (%s) to target (%s): %v", conn.RemoteAddr(), target.RemoteAddr(), err)
 		} else if err != nil && s.status.Load() == StatusRunning {
@@ -344,8 +461,8 @@ func (s *SshServer) forward(remoteAddr string, conn net.Conn, target net.Conn, r
 		}
 	}()
 
+	wg.Add(1)
 	go func() {
-		wg.Add(1)
 		defer wg.Done()
 
 		//defer func() {
@@ -358,11 +475,21 @@ func (s *SshServer) forward(remoteAddr string, conn net.Conn, target net.Conn, r
 		//	}
 		//}()
 
-		defer func() {
-			close(stopchan2)
-		}()
+		_, err := sess.copy(conn, target, &sess.download, sess.bandwidth.download, nil)
+		if err == nil && !sess.isFinished() {
+			sess.end(database.DisconnectUpstream, "回源地址断开连接。")
+			halfClosed <- closeWrite(conn) == nil // 失败时（例如对端已经断开）直接结束整个会话
+			return
+		}
+
+		halfClosed <- false
+
+		if err != nil && (sess.isClosed() || sess.isFinished()) {
+			return // 主动断开，不记录错误
+		} else if err != nil {
+			sess.end(database.DisconnectError, fmt.Sprintf("转发出错（回源地址 -> 客户端）：%s。", err.Error()))
+		}
 
-		_, err := io.Copy(conn, target)
 		if err != nil && conn != nil && target != nil && s.status.Load() == StatusRunning {
 			logger.Errorf("failed to forward target (%s) to conn (%s): %v", target.RemoteAddr(), conn.RemoteAddr(), err)
 		} else if err != nil && s.status.Load() == StatusRunning {
@@ -370,263 +497,740 @@ func (s *SshServer) forward(remoteAddr string, conn net.Conn, target net.Conn, r
 		}
 	}()
 
+	defer sess.finish()
+
+	go sess.watch(s.getConfig().Session.IdleTimeoutDuration, s.getConfig().Session.MaxSessionTimeDuration)
+
+	if !<-halfClosed {
+		return // 出错或被主动断开，直接结束整个会话
+	}
+
+	// 一个方向已经结束并传递给了另一端，等待另一个方向结束
+	linger := s.getConfig().Session.HalfCloseLingerDuration
+	if linger == 0 {
+		return
+	}
+
+	var lingerChan <-chan time.Time
+	if linger > 0 {
+		lingerTimer := time.NewTimer(linger)
+		defer lingerTimer.Stop()
+		lingerChan = lingerTimer.C
+	}
+
 	select {
-	case <-stopchan1:
-	case <-stopchan2:
+	case <-halfClosed:
+	case <-lingerChan:
+		sess.close(database.DisconnectTimeout, fmt.Sprintf("一个方向结束后，另一个方向在 %s 内没有结束，连接被断开。", linger.String()))
 	}
 
 	return
 }
 
-func (s *SshServer) accept(ln net.Listener, srcNetwork string, destProxy bool, destProxyVersion int, targetNetwork string, targetAddr *net.TCPAddr) string {
+func (s *SshServer) accept(l *listener) string {
 	defer func() {
 		if r := recover(); r != nil {
 			if err, ok := r.(error); ok {
-				logger.Panicf("listen on %d panic (error) : %s", s.config.SrcPort, err.Error())
+				logger.Panicf("forward %s listen on %s panic (error) : %s", s.getConfig().Name, l.address, err.Error())
 			} else {
-				logger.Panicf("listen on %d panic : %s", s.config.SrcPort, err.Error())
+				logger.Panicf("forward %s listen on %s panic : %v", s.getConfig().Name, l.address, r)
 			}
 		}
 	}()
 
-	if ln == nil {
+	if l.ln == nil {
 		return StatusStop
 	}
 
-	conn, err := ln.Accept()
+	conn, err := l.ln.Accept()
 	if err != nil {
-		logger.Errorf("listen on %d accecpt error: %s", s.config.SrcPort, err.Error())
+		select {
+		case <-s.stopchan:
+			return StatusStop // 监听已被关闭
+		default:
+			// pass
+		}
+
+		logger.Errorf("forward %s listen on %s accecpt error: %s", s.getConfig().Name, l.address, err.Error())
 		return StatusContinue
 	}
+
+	if !l.proxy { // 使用 Proxy 协议时需要读取头部后才能得知来源IP，见 check
+		if peer, ok := conn.RemoteAddr().(*net.TCPAddr); ok && !s.connRate.allow(peer.IP) {
+			_ = conn.Close()
+			return StatusContinue
+		}
+	}
+
+	s.enqueue(&pendingConn{
+		conn:     conn,
+		l:        l,
+		accepted: time.Now(),
+	})
+
+	return StatusContinue
+}
+
+// check 检查新连接（读取头部、IP检查、连接回源地址），决定转发、拒绝或交给 tarpit 和蜜罐，在工作协程中运行
+func (s *SshServer) check(p *pendingConn) {
+	defer func() {
+		if r := recover(); r != nil {
+			if err, ok := r.(error); ok {
+				logger.Panicf("forward %s listen on %s panic (error) : %s", s.getConfig().Name, p.l.address, err.Error())
+			} else {
+				logger.Panicf("forward %s listen on %s panic : %v", s.getConfig().Name, p.l.address, r)
+			}
+		}
+	}()
+
+	l := p.l
+	conn := p.conn
+	now := p.accepted
+
+	defer func() {
+		s.acceptStats.observe(time.Since(now))
+	}()
 	defer func() {
 		if conn != nil {
 			_ = conn.Close()
 		}
 	}()
 
-	now := time.Now()
+	pool := l.pool
+
+	var deadline time.Time // 判定时限，零值表示不限制
+	if d := s.getConfig().Accept.DecisionTimeoutDuration; d > 0 {
+		deadline = now.Add(d)
+	}
+
+	if s.deadlineExceeded(deadline) { // 排队超时，与排队已满相同，不记录到数据库
+		return
+	}
+
+	err := setSocketOptions(conn, &s.getConfig().Session)
+	if err != nil {
+		logger.Warnf("forward %s set socket options on conn error: %s", s.getConfig().Name, err.Error())
+	}
+
+	if l.proxy {
+		pconn, err := s.srcProxyConn(conn, deadline)
+		if err != nil {
+			mark := err.Error()
+			if s.deadlineExceeded(deadline) {
+				mark = decisionTimeoutMark + mark
+			}
+
+			if peer, ok := conn.RemoteAddr().(*net.TCPAddr); ok {
+				_, _ = s.addSshConnectRecordNotSend(peer.IP, peer.String(), pool.String(), nil, "", false, now, mark)
+			}
+			return
+		}
+
+		conn = pconn
+	}
+
+	peer := peerAddress(conn)
 
 	remoteAddr := conn.RemoteAddr()
 	if remoteAddr == nil {
-		return StatusContinue
+		return
 	}
 
-	remoteSSHAddr, err := net.ResolveTCPAddr(srcNetwork, remoteAddr.String())
+	remoteSSHAddr, err := net.ResolveTCPAddr("tcp", remoteAddr.String()) // 外部传入的双栈监听中 ipv4 来访地址为映射地址
 	if err != nil {
-		return StatusContinue
+		return
 	}
 
-	headerData := make([]byte, len(s.config.HeaderBytes))
+	if l.proxy && !s.connRate.allow(remoteSSHAddr.IP) {
+		return
+	}
 
-	if len(headerData) != 0 && s.config.HeaderCheck.IsEnable(true) {
-		err := conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	var headerData []byte
+	var clientVersion string
+
+	protocol := config.MuxProtocolSSH
+	var route *config.SshMuxRouteConfig // 非 SSH 连接的转发目标
+	var protoMark string                // 按协议分流时识别的协议，写入之后的连接记录
+
+	if s.getConfig().Mux.IsEnable() {
+		err := conn.SetReadDeadline(earlier(s.getConfig().Mux.PeekTimeoutDuration, deadline))
 		if err != nil {
-			_, _ = s.addSshConnectRecordNotSend(remoteSSHAddr.IP, targetAddr, nil, false, now, fmt.Sprintf("读取请求头前设置读取超时失败：%s。", err.Error()))
-			return StatusContinue
+			_, _ = s.addSshConnectRecordNotSend(remoteSSHAddr.IP, peer, pool.String(), nil, "", false, now, fmt.Sprintf("识别协议前设置读取超时失败：%s。", err.Error()))
+			return
 		}
 
-		n, err := conn.Read(headerData)
+		var sni string
+		protocol, sni, headerData, err = sniff(conn)
 		if err != nil {
-			_, _ = s.addSshConnectRecordNotSend(remoteSSHAddr.IP, targetAddr, nil, false, now, fmt.Sprintf("读取请求头部信息错误：%s。", err.Error()))
-			return StatusContinue
-		} else if n != len(s.config.HeaderBytes) {
-			_, _ = s.addSshConnectRecordNotSend(remoteSSHAddr.IP, targetAddr, nil, false, now, fmt.Sprintf("读取请求头部信息错误：读取字节数 %d 和预期字节数 %d 不符。", n, len(s.config.HeaderBytes)))
-			return StatusContinue
+			mark := fmt.Sprintf("识别协议时读取数据错误：%s。", err.Error())
+			if s.deadlineExceeded(deadline) {
+				mark = decisionTimeoutMark + mark
+			}
+
+			_, _ = s.addSshConnectRecordNotSend(remoteSSHAddr.IP, peer, pool.String(), nil, "", false, now, mark)
+			return
+		} else if s.deadlineExceeded(deadline) { // 读取超时可能是判定时限造成的
+			_, _ = s.addSshConnectRecordNotSend(remoteSSHAddr.IP, peer, pool.String(), nil, "", false, now, decisionTimeoutMark+"识别协议耗时过长。")
+			return
+		}
+
+		protoMark = muxMark(protocol, sni)
+
+		if protocol != config.MuxProtocolSSH {
+			i := s.getConfig().Mux.Match(protocol, sni) // 转发目标变化时会重启转发，序号与 muxPools 一致
+			if i < 0 {
+				_, _ = s.addSshConnectRecordNotSend(remoteSSHAddr.IP, peer, pool.String(), nil, "", false, now, protoMark+"没有对应的转发目标。")
+				return
+			}
+
+			route = s.getConfig().Mux.Routes[i]
+			pool = s.muxPools[i]
 		}
 
 		err = conn.SetReadDeadline(time.Time{})
 		if err != nil {
-			_, _ = s.addSshConnectRecordNotSend(remoteSSHAddr.IP, targetAddr, nil, false, now, fmt.Sprintf("读取请求头后借出读取超时失败：%s。", err.Error()))
-			return StatusContinue
+			_, _ = s.addSshConnectRecordNotSend(remoteSSHAddr.IP, peer, pool.String(), nil, "", false, now, protoMark+fmt.Sprintf("识别协议后借出读取超时失败：%s。", err.Error()))
+			return
+		}
+	}
+
+	if protocol == config.MuxProtocolSSH && s.getConfig().HeaderCheck.IsEnable(true) {
+		err := conn.SetReadDeadline(earlier(5*time.Second, deadline))
+		if err != nil {
+			_, _ = s.addSshConnectRecordNotSend(remoteSSHAddr.IP, peer, pool.String(), nil, "", false, now, fmt.Sprintf("读取请求头前设置读取超时失败：%s。", err.Error()))
+			return
+		}
+
+		headerData, err = readIdentification(conn, headerData)
+		clientVersion = identificationString(headerData)
+		if err != nil {
+			mark := fmt.Sprintf("读取请求头部信息错误：%s。", err.Error())
+			if s.deadlineExceeded(deadline) {
+				mark = decisionTimeoutMark + mark
+			}
+
+			_, _ = s.addSshConnectRecordNotSend(remoteSSHAddr.IP, peer, pool.String(), nil, clientVersion, false, now, mark)
+			return
+		}
+
+		err = conn.SetReadDeadline(time.Time{})
+		if err != nil {
+			_, _ = s.addSshConnectRecordNotSend(remoteSSHAddr.IP, peer, pool.String(), nil, clientVersion, false, now, fmt.Sprintf("读取请求头后借出读取超时失败：%s。", err.Error()))
+			return
 		}
 
 		if !s.isSSHRequests(headerData) {
-			_, _ = s.addSshConnectRecordNotSend(remoteSSHAddr.IP, targetAddr, nil, false, now, fmt.Sprintf("读取请求头部信息错误：非SSH请求。"))
-			return StatusContinue
+			_, _ = s.addSshConnectRecordNotSend(remoteSSHAddr.IP, peer, pool.String(), nil, clientVersion, false, now, fmt.Sprintf("读取请求头部信息错误：非SSH请求。"))
+			return
 		}
 	}
 
-	loc, ckErr := s.remoteAddrCheck(remoteSSHAddr, targetAddr)
+	loc, rule, ckErr := s.remoteAddrCheck(remoteSSHAddr, clientVersion)
 	if ckErr != nil {
-		_, _ = s.addSshConnectRecord(remoteSSHAddr.IP, targetAddr, loc, false, now, fmt.Sprintf("来访IP检查出现问题。%s", ckErr.Error()))
-		return StatusContinue
+		mark := protoMark + fmt.Sprintf("来访IP检查出现问题。%s", ckErr.Error())
+		if protocol != config.MuxProtocolSSH { // tarpit、蜜罐和提示信息只适用于 SSH，其他协议直接断开
+			_, _ = s.addSshConnectRecord(remoteSSHAddr.IP, peer, pool.String(), loc, clientVersion, false, now, mark)
+			return
+		}
+
+		switch checkAction(ckErr) {
+		case config.ActionTarpit:
+			if s.startTarpit(conn, remoteSSHAddr.IP, pool.String(), loc, clientVersion, now, mark) {
+				conn = nil // 连接由 tarpit 负责关闭
+			}
+			return
+		case config.ActionHoneypot:
+			if s.startHoneypot(conn, headerData, remoteSSHAddr.IP, pool.String(), loc, clientVersion, now, mark) {
+				conn = nil // 连接由蜜罐负责关闭
+			}
+			return
+		}
+
+		if notice := checkNotice(ckErr); notice != "" {
+			err := sendPreBanner(conn, notice)
+			if err != nil {
+				mark += fmt.Sprintf("发送提示信息失败：%s。", err.Error())
+			} else {
+				mark += "已发送提示信息。"
+			}
+		}
+
+		_, _ = s.addSshConnectRecord(remoteSSHAddr.IP, peer, pool.String(), loc, clientVersion, false, now, mark)
+		return
+	}
+
+	if s.deadlineExceeded(deadline) { // IP定位或者数据库查询过慢
+		_, _ = s.addSshConnectRecordNotSend(remoteSSHAddr.IP, peer, pool.String(), loc, clientVersion, false, now, decisionTimeoutMark+protoMark+"来访IP检查耗时过长。")
+		return
+	}
+
+	if s.getConfig().Maintenance.IsEnable() { // 维护模式，发送提示信息后断开，不连接回源地址
+		mark := protoMark + "转发处于维护模式。"
+		if protocol == config.MuxProtocolSSH { // 提示信息只适用于 SSH
+			mark = protoMark + "转发处于维护模式，已发送提示信息。"
+			err := sendPreBanner(conn, s.getConfig().Maintenance.Message)
+			if err != nil {
+				mark = protoMark + fmt.Sprintf("转发处于维护模式，发送提示信息失败：%s。", err.Error())
+			}
+		}
+
+		_, _ = s.addSshConnectRecordNotSend(remoteSSHAddr.IP, peer, pool.String(), loc, clientVersion, false, now, mark)
+		return
 	}
 
-	target, err := net.DialTCP(targetNetwork, nil, targetAddr)
+	limitKey := newSessionLimitKey(remoteSSHAddr.IP, loc)
+	err = s.limiter.acquire(limitKey)
 	if err != nil {
-		logger.Errorf("Failed to connect to target %s: %v", targetAddr.String(), err)
-		_, _ = s.addSshConnectRecord(remoteSSHAddr.IP, targetAddr, loc, false, now, "无法解析来访TCP地址。")
-		return StatusContinue
+		_, _ = s.addSshConnectRecord(remoteSSHAddr.IP, peer, pool.String(), loc, clientVersion, false, now, protoMark+err.Error())
+		return
 	}
+	defer func() {
+		if limitKey != nil {
+			s.limiter.release(limitKey)
+		}
+	}()
+
+	destProxy := s.getConfig().IPv4DestRequestProxy.IsEnable(true)
+	destProxyVersion := s.getConfig().IPv4DestRequestProxyVersion
+	if route != nil {
+		destProxy = route.Proxy.IsEnable(false)
+		destProxyVersion = route.ProxyVersion
+	} else if l.network == "tcp6" {
+		destProxy = s.getConfig().IPv6DestRequestProxy.IsEnable(true)
+		destProxyVersion = s.getConfig().IPv6DestRequestProxyVersion
+	}
+
+	a := &authorizedConn{
+		conn:             conn,
+		l:                l,
+		pool:             pool,
+		protocol:         protocol,
+		destProxy:        destProxy,
+		destProxyVersion: destProxyVersion,
+		remoteAddr:       remoteAddr,
+		remoteSSHAddr:    remoteSSHAddr,
+		peer:             peer,
+		loc:              loc,
+		rule:             rule,
+		clientVersion:    clientVersion,
+		headerData:       headerData,
+		identLength:      len(headerData),
+		accepted:         now,
+		limitKey:         limitKey,
+	}
+
+	target, b, dialMark, err := s.dialBackend(context.Background(), pool, remoteSSHAddr.IP, deadline, false)
+	dialMark = protoMark + dialMark
+	if err != nil {
+		if s.deadlineExceeded(deadline) {
+			_, _ = s.addSshConnectRecord(remoteSSHAddr.IP, peer, pool.String(), loc, clientVersion, false, now, decisionTimeoutMark+dialMark+"无法连接回源地址。")
+			return
+		}
+
+		if s.startHold(a, dialMark) {
+			conn = nil // 连接和并发会话名额由 hold 负责
+			limitKey = nil
+			return
+		}
+
+		_, _ = s.addSshConnectRecord(remoteSSHAddr.IP, peer, pool.String(), loc, clientVersion, false, now, dialMark+"无法连接回源地址。")
+		return
+	}
+
+	conn = nil // 连接和并发会话名额由 establish 负责
+	limitKey = nil
+	s.establish(a, target, b, dialMark)
+}
+
+// authorizedConn 已通过检查、等待连接回源地址的客户端连接
+type authorizedConn struct {
+	conn             net.Conn
+	l                *listener
+	pool             *backendPool // 回源地址，按协议分流时为对应的转发目标
+	protocol         string       // 按协议分流时识别的协议，未启用时为 ssh
+	destProxy        bool         // 是否向回源地址发送 Proxy 协议头部
+	destProxyVersion int
+	remoteAddr       net.Addr
+	remoteSSHAddr    *net.TCPAddr // 规则使用的来访地址（使用 Proxy 协议时为头部中声明的来源）
+	peer             string
+	loc              *apiip.QueryIpLocationData
+	rule             *config.SshRuleConfig
+	clientVersion    string
+	headerData       []byte // 事先读取的SSH标识行（或者识别协议时读取的数据），hold 期间客户端发送的数据追加在后面
+	identLength      int    // headerData 中检查时读取的部分，之后的数据需要交给客户端指纹解析
+	accepted         time.Time
+	limitKey         *sessionLimitKey
+}
+
+// reject 无法建立转发，保存拒绝的连接记录，关闭连接并释放并发会话名额
+func (s *SshServer) reject(a *authorizedConn, mark string) {
+	_, _ = s.addSshConnectRecord(a.remoteSSHAddr.IP, a.peer, a.pool.String(), a.loc, a.clientVersion, false, a.accepted, mark)
+	_ = a.conn.Close()
+	s.limiter.release(a.limitKey)
+}
+
+// establish 已连接回源地址，写入 Proxy 协议头部和事先读取的SSH标识行后开始转发，失败时关闭连接并释放并发会话名额
+func (s *SshServer) establish(a *authorizedConn, target net.Conn, b *backend, dialMark string) {
+	conn := a.conn
+	limitKey := a.limitKey
+
+	defer func() {
+		if conn != nil {
+			_ = conn.Close()
+		}
+	}()
+	defer func() {
+		if limitKey != nil {
+			s.limiter.release(limitKey)
+		}
+	}()
 	defer func() {
 		if target != nil {
 			_ = target.Close()
 		}
 	}()
 
-	if destProxy {
-		header := proxyproto.HeaderProxyFromAddrs(byte(destProxyVersion), remoteSSHAddr, targetAddr)
+	err := setSocketOptions(target, &s.getConfig().Session)
+	if err != nil {
+		logger.Warnf("forward %s set socket options on target error: %s", s.getConfig().Name, err.Error())
+	}
+
+	proxyDestAddr, ok := b.addr.(*net.TCPAddr)
+	if !ok { // 回源地址为 Unix 套接字时，Proxy 协议头部使用来访连接的本地地址
+		proxyDestAddr, ok = conn.LocalAddr().(*net.TCPAddr)
+	}
+
+	// 先保存连接记录（不发送通知），Proxy 协议头部的 TLV 需要使用记录的 ID；写入回源连接失败时再将记录改为拒绝
+	record, err := s.addSshConnectRecordNotSend(a.remoteSSHAddr.IP, a.peer, b.address, a.loc, a.clientVersion, true, a.accepted, dialMark+"允许建立连接。")
+	if err != nil {
+		logger.Errorf("Fail to save ssh connect record to database: %s", err.Error())
+		_, _ = s.addSshConnectRecord(a.remoteSSHAddr.IP, a.peer, b.address, a.loc, a.clientVersion, true, a.accepted, "无法记录SSH数据，不允许建立连接。")
+		return
+	}
+
+	if a.destProxy && ok && isSameFamily(a.remoteSSHAddr.IP, proxyDestAddr.IP) { // 跨协议转发（例如 ipv4 转发到 ipv6）不使用Proxy协议
+		header := proxyproto.HeaderProxyFromAddrs(byte(a.destProxyVersion), a.remoteSSHAddr, proxyDestAddr)
+		if header.Version == 2 {
+			tlvs := s.destProxyTLVs(conn, record, a.rule)
+			if len(tlvs) > 0 {
+				err = header.SetTLVs(tlvs)
+				if err != nil {
+					logger.Warnf("forward %s set proxy header tlv error: %s", s.getConfig().Name, err.Error())
+				}
+			}
+		}
+
 		_, err = header.WriteTo(target)
 		if err != nil {
-			logger.Errorf("Failed to write proxy header to target %s: %v", targetAddr.String(), err)
-			_, _ = s.addSshConnectRecord(remoteSSHAddr.IP, targetAddr, loc, false, now, "无法写入Proxy协议头部。")
-			return StatusContinue
+			logger.Errorf("Failed to write proxy header to target %s: %v", b.address, err)
+			s.rejectSshConnectRecord(record, a.loc, dialMark+"无法写入Proxy协议头部。")
+			return
 		}
 	}
 
-	if headerData != nil && len(headerData) != 0 && s.config.HeaderCheck.IsEnable(true) {
+	headerData := a.headerData
+	if len(headerData) != 0 { // 未启用 header-check 且未按协议分流时为空
 		n, err := target.Write(headerData)
 		if err != nil {
-			logger.Errorf("Failed to write SSH header to target %s: %v", targetAddr.String(), err)
-			_, _ = s.addSshConnectRecord(remoteSSHAddr.IP, targetAddr, loc, false, now, "无法写入事先读取的SSH协议头部。")
-			return StatusContinue
+			logger.Errorf("Failed to write SSH header to target %s: %v", b.address, err)
+			s.rejectSshConnectRecord(record, a.loc, dialMark+"无法写入事先读取的数据。")
+			return
 		} else if n != len(headerData) {
-			_, _ = s.addSshConnectRecord(remoteSSHAddr.IP, targetAddr, nil, false, now, fmt.Sprintf("无法写入事先读取的SSH协议头部：写入字节数 %d 和预期字节数 %d 不符。", n, len(headerData)))
-			return StatusContinue
+			s.rejectSshConnectRecord(record, a.loc, dialMark+fmt.Sprintf("无法写入事先读取的数据：写入字节数 %d 和预期字节数 %d 不符。", n, len(headerData)))
+			return
 		}
 	}
 
-	record, err := s.addSshConnectRecord(remoteSSHAddr.IP, targetAddr, loc, true, now, "允许建立连接。")
-	if err != nil {
-		logger.Errorf("Fail to save ssh connect record to database: %s", err.Error())
-		_, _ = s.addSshConnectRecord(remoteSSHAddr.IP, targetAddr, loc, true, now, "无法记录SSH数据，不允许建立连接。")
-		return StatusContinue
-	}
+	notify.SendSshSuccess(s.getConfig().Name, record.From, a.loc, record.To, record.Mark)
 
 	_conn := conn
 	_target := target
 	conn = nil
 	target = nil
-	go s.forward(remoteAddr.String(), _conn, _target, record)
+	_limitKey := limitKey
+	limitKey = nil
+	bandwidth := newSessionBandwidth(s.bandwidth, &s.getConfig().Bandwidth, a.remoteSSHAddr.IP, a.rule)
+	sess := newSession(a.remoteAddr.String(), a.remoteSSHAddr.IP, a.loc, _conn, _target, b, record, _limitKey, bandwidth)
+	sess.protocol = a.protocol
+	sess.upload.Store(int64(len(headerData))) // 事先读取的数据
+
+	tap := s.newClientTap(sess)
+	if tap != nil && len(headerData) > a.identLength {
+		tap(headerData[a.identLength:]) // hold 期间客户端发送的数据（可能包含 SSH_MSG_KEXINIT），指纹检查不通过时会话在此断开
+	}
 
-	return StatusContinue
+	s.swg.Add(1)
+	go s.forward(sess, tap)
+
+	return
 }
 
-func (s *SshServer) remoteAddrCheck(remoteAddr *net.TCPAddr, to *net.TCPAddr) (loc *apiip.QueryIpLocationData, err error) {
+func (s *SshServer) remoteAddrCheck(remoteAddr *net.TCPAddr, clientVersion string) (loc *apiip.QueryIpLocationData, rule *config.SshRuleConfig, err error) {
+	cfg := s.getConfig() // 同一次检查中使用同一份配置，避免重载时新旧规则混用
+
 	ip := remoteAddr.IP
 	if ip == nil {
-		return nil, fmt.Errorf("无法获取IP")
+		return nil, nil, fmt.Errorf("无法获取IP")
 	}
 
 	loc, err = redisserver.QueryNetIpLocation(ip)
 	if err != nil {
 		logger.Errorf("failed to query ip location: %s", err.Error())
-		return loc, fmt.Errorf("查询IP定位失败（%s）。", err.Error())
+		return loc, nil, fmt.Errorf("查询IP定位失败（%s）。", err.Error())
 	} else if loc == nil {
 		logger.Panicf("failed to query ip location: loc is nil")
-		return loc, fmt.Errorf("查询IP定位失败（loc is nil）。")
+		return loc, nil, fmt.Errorf("查询IP定位失败（loc is nil）。")
 	}
 
 	isLoopback := ip.IsLoopback()
 	isIntranet := isLoopback || ip.IsPrivate()
 
-	if isLoopback && (config.GetConfig().SSH.RuleList.AlwaysAllowIntranet.IsEnable(false) || config.GetConfig().SSH.RuleList.AlwaysAllowLoopback.IsEnable(true)) {
-		return loc, nil
+	if isLoopback && (cfg.ResolveRuleList.AlwaysAllowIntranet.IsEnable(false) || cfg.ResolveRuleList.AlwaysAllowLoopback.IsEnable(true)) {
+		return loc, nil, nil
 	}
 
 	if !database.SshCheckIP(ip.String()) {
-		return nil, fmt.Errorf("IP地址被SQLite中定义的规则（IP）封禁。")
+		return nil, nil, fmt.Errorf("IP地址被SQLite中定义的规则（IP）封禁。")
 	}
 
-	if isIntranet && config.GetConfig().SSH.RuleList.AlwaysAllowIntranet.IsEnable(false) {
-		return loc, nil
+	if isIntranet && cfg.ResolveRuleList.AlwaysAllowIntranet.IsEnable(false) {
+		return loc, nil, nil
 	}
 
 	if !database.SshCheckLocationNation(loc.Nation) {
-		return loc, fmt.Errorf("IP地址被SQLite中定义的规则（地区-国家）封禁。")
+		return loc, nil, fmt.Errorf("IP地址被SQLite中定义的规则（地区-国家）封禁。")
 	}
 
 	if !database.SshCheckLocationProvince(loc.Province) {
-		return loc, fmt.Errorf("IP地址被SQLite中定义的规则（地区-省份）封禁。")
+		return loc, nil, fmt.Errorf("IP地址被SQLite中定义的规则（地区-省份）封禁。")
 	}
 
 	if !database.SshCheckLocationCity(loc.City) {
-		return loc, fmt.Errorf("IP地址被SQLite中定义的规则（地区-城市）封禁。")
+		return loc, nil, fmt.Errorf("IP地址被SQLite中定义的规则（地区-城市）封禁。")
 	}
 
 	if !database.SshCheckLocationISP(loc.Isp) {
-		return loc, fmt.Errorf("IP地址被SQLite中定义的规则（地区-ISP）封禁。")
+		return loc, nil, fmt.Errorf("IP地址被SQLite中定义的规则（地区-ISP）封禁。")
 	}
 
-	rcErr := s.countRulesCheck(ip, to, s.config.CountRules)
+	rcErr := s.countRulesCheck(ip, cfg.CountRules)
 	if rcErr != nil {
-		return loc, rcErr
+		return loc, nil, rcErr
+	}
+
+	for _, r := range cfg.ResolveRuleList.RuleList {
+		if r.HasHASSH() { // 指纹需要在连接建立后才能获取，见 hasshCheck
+			continue
+		}
+
+		ok, err := s.ruleMatch(r, ip, loc, clientVersion)
+		if err != nil {
+			return loc, nil, err
+		} else if !ok {
+			continue
+		}
+
+		if r.Banned.ToBool(true) { // true - 封禁
+			return loc, r, newRejectError(r.Action, "IP在配置文件规则策略中被封禁。", r.Message)
+		}
+
+		return loc, r, nil
+	}
+
+	if cfg.ResolveRuleList.DefaultBanned.ToBool(true) { // true - 封禁
+		return loc, nil, newRejectError(cfg.ResolveRuleList.DefaultBannedAction, "IP在配置文件默认兜底规则策略中被封禁。", cfg.ResolveRuleList.DefaultBannedMessage)
+	}
+
+	return loc, nil, nil
+}
+
+// onClientKexInit 获取到客户端的 HASSH 指纹后记录到数据库并检查，未通过检查则断开会话
+// newClientTap 解析客户端发往回源地址的数据得到客户端指纹，只有 SSH 连接需要解析，其他协议返回 nil
+func (s *SshServer) newClientTap(sess *session) func(p []byte) {
+	if sess.protocol != config.MuxProtocolSSH {
+		return nil
+	}
+
+	return newKexInitParser(!s.getConfig().HeaderCheck.IsEnable(true), func(hassh string, algorithms string) {
+		s.onClientKexInit(sess, hassh, algorithms)
+	}).write
+}
+
+func (s *SshServer) onClientKexInit(sess *session, hassh string, algorithms string) {
+	sess.hassh.Store(&hassh)
+
+	ckErr := s.hasshCheck(sess.ip, sess.loc, sess.recordCopy().ClientVersion.String, hassh) // 先检查再记录，计数时不包括本次连接
+
+	err := sess.updateRecord(func(record *database.SshConnectRecord) error {
+		return database.UpdateSshConnectRecordHASSH(record, hassh, algorithms)
+	})
+	if err != nil {
+		logger.Errorf("update ssh connect record hassh error: %s", err.Error())
+	}
+
+	if ckErr != nil {
+		sess.close(database.DisconnectPolicy, fmt.Sprintf("客户端指纹（HASSH %s）检查出现问题。%s", hassh, ckErr.Error()))
+	}
+}
+
+func (s *SshServer) hasshCheck(ip net.IP, loc *apiip.QueryIpLocationData, clientVersion string, hassh string) error {
+	cfg := s.getConfig()
+
+	isLoopback := ip.IsLoopback()
+	isIntranet := isLoopback || ip.IsPrivate()
+
+	if isLoopback && (cfg.ResolveRuleList.AlwaysAllowIntranet.IsEnable(false) || cfg.ResolveRuleList.AlwaysAllowLoopback.IsEnable(true)) {
+		return nil
 	}
 
-RuleCycle:
-	for _, r := range config.GetConfig().SSH.RuleList.RuleList {
-		if loc.Isp == redisserver.IspIntranet || loc.Isp == redisserver.IspLoopback {
-			if r.HasLocation() {
-				continue RuleCycle
+	if !redisserver.QuerySSHHASSHBanned(hassh) {
+		return fmt.Errorf("客户端指纹已被Redis封禁。")
+	}
+
+	if !database.SshCheckHASSH(hassh) {
+		return fmt.Errorf("客户端指纹被SQLite中定义的规则封禁。")
+	}
+
+	if isIntranet && cfg.ResolveRuleList.AlwaysAllowIntranet.IsEnable(false) {
+		return nil
+	}
+
+	if loc != nil {
+		for _, r := range cfg.ResolveRuleList.RuleList {
+			if !r.CheckHASSH(hassh) {
+				continue
 			}
-		} else {
-			ok, err := loc.CheckLocation(&r.RuleConfig)
+
+			ok, err := s.ruleMatch(r, ip, loc, clientVersion)
 			if err != nil {
-				logger.Errorf("check location error: %s", err.Error())
-				return loc, fmt.Errorf("在配置文件规则策略中，检测IP地址错误。")
-			} else if !ok {
-				continue RuleCycle
+				return err
+			} else if ok && r.Banned.ToBool(true) {
+				return fmt.Errorf("客户端指纹在配置文件规则策略中被封禁。")
 			}
 		}
+	}
 
-		ok, err := r.CheckIP(ip)
+	return s.hasshCountRulesCheck(hassh, cfg.CountRules)
+}
+
+func (s *SshServer) hasshCountRulesCheck(hassh string, countRules []*config.SshCountRuleConfig) error {
+	now := time.Now()
+
+	hasshRules := make([]*config.SshCountRuleConfig, 0, len(countRules))
+	for _, r := range countRules {
+		if r.Key == config.CountRuleKeyHASSH {
+			hasshRules = append(hasshRules, r)
+		}
+	}
+
+	if len(hasshRules) == 0 {
+		return nil
+	}
+
+	limit := int(hasshRules[0].TryCount + 1) // +1防止TryCount是0
+	after := now.Add(-1 * time.Second * time.Duration(hasshRules[0].Seconds))
+
+	res, err := database.FindSshConnectRecordByHASSH(s.getConfig().Name, hassh, limit, after)
+	if err != nil {
+		logger.Errorf("hassh count rules check error: %s", err.Error())
+		return nil // 指纹检查在连接建立后进行，数据库异常时不断开已建立的连接
+	}
+
+	for _, r := range hasshRules {
+		if s._countRulesCheck(res, r, now) {
+			err := redisserver.SetSSHHASSHBanned(hassh, time.Duration(r.BannedSeconds)*time.Second)
+			if err != nil {
+				logger.Errorf("hassh count rules check error: %s", err.Error())
+			}
+			s.kickBanWatch()
+			return fmt.Errorf("客户端指纹在配置文件计数策略中被封禁, 时长 %d 秒。", r.BannedSeconds)
+		}
+	}
+
+	return nil
+}
+
+// ruleMatch 检查规则的地区、IP和客户端标识是否全部命中（HASSH 指纹由调用者检查）
+func (s *SshServer) ruleMatch(r *config.SshRuleConfig, ip net.IP, loc *apiip.QueryIpLocationData, clientVersion string) (bool, error) {
+	if loc.Isp == redisserver.IspIntranet || loc.Isp == redisserver.IspLoopback {
+		if r.HasLocation() {
+			return false, nil
+		}
+	} else {
+		ok, err := loc.CheckLocation(&r.RuleConfig)
 		if err != nil {
-			logger.Errorf("check ip error: %s", err.Error())
-			return loc, fmt.Errorf("在配置文件规则策略中，检测IP信息错误。")
+			logger.Errorf("check location error: %s", err.Error())
+			return false, fmt.Errorf("在配置文件规则策略中，检测IP地址错误。")
 		} else if !ok {
-			continue RuleCycle
+			return false, nil
 		}
+	}
 
-		if r.Banned.ToBool(true) { // true - 封禁
-			return loc, fmt.Errorf("IP在配置文件规则策略中被封禁。")
+	if r.HasIP() { // 没有IP信息的规则（例如仅按客户端软件匹配）对所有IP生效
+		ok, err := r.CheckIP(ip)
+		if err != nil {
+			logger.Errorf("check ip error: %s", err.Error())
+			return false, fmt.Errorf("在配置文件规则策略中，检测IP信息错误。")
+		} else if !ok {
+			return false, nil
 		}
-
-		return loc, nil
 	}
 
-	if config.GetConfig().SSH.RuleList.DefaultBanned.ToBool(true) { // true - 封禁
-		return loc, fmt.Errorf("IP在配置文件默认兜底规则策略中被封禁。")
+	if r.HasClientVersion() && !r.CheckClientVersion(clientVersion) {
+		return false, nil
 	}
 
-	return loc, nil
+	return true, nil
 }
 
-func (s *SshServer) countRulesCheck(ip net.IP, to *net.TCPAddr, countRules []*config.SshCountRuleConfig) error {
+func (s *SshServer) countRulesCheck(ip net.IP, countRules []*config.SshCountRuleConfig) error {
 	now := time.Now()
 
 	if !redisserver.QuerySSHIpBanned(ip.String()) {
+		action := redisserver.QuerySSHIpBannedAction(ip.String())
+		if action == config.ActionTarpit || action == config.ActionHoneypot {
+			return newCheckError(action, "IP在配置文件计数策略中被封禁，IP已被Redis封禁。")
+		}
 		return fmt.Errorf("IP在配置文件计数策略中被封禁，IP已被Redis封禁。")
 	}
 
-	if len(countRules) > 0 {
-		limit := int(countRules[0].TryCount + 1) // +1防止TryCount是0
-		after := now.Add(-1 * time.Second * time.Duration(countRules[0].Seconds))
+	ipRules := make([]*config.SshCountRuleConfig, 0, len(countRules))
+	for _, r := range countRules {
+		if r.Key == config.CountRuleKeyIP {
+			ipRules = append(ipRules, r)
+		}
+	}
+
+	if len(ipRules) > 0 {
+		limit := int(ipRules[0].TryCount + 1) // +1防止TryCount是0
+		after := now.Add(-1 * time.Second * time.Duration(ipRules[0].Seconds))
 
-		res, err := database.FindSshConnectRecord("", ip, to, limit, after)
+		res, err := database.FindSshConnectRecord(s.getConfig().Name, "", ip, limit, after)
 		if err != nil {
 			logger.Errorf("count rules check error: %s", err.Error())
 			return fmt.Errorf("从数据库读取SSH记录异常，禁止连接。")
 		}
 
-		for _, r := range countRules {
-			if s._countRulesCheck(res, r, now) {
+		for _, r := range ipRules {
+			if s._countRulesCheck(res, r, now) || s._transferRulesCheck(ip, r, now) {
 				if r.BannedSeconds <= 0 {
 					return nil // 返回是否放行，true表示放行
 				}
 
-				err := redisserver.SetSSHIpBanned(ip.String(), time.Duration(r.BannedSeconds)*time.Second)
+				err := redisserver.SetSSHIpBanned(ip.String(), time.Duration(r.BannedSeconds)*time.Second, r.Action)
 				if err != nil {
 					logger.Errorf("count rules check error: %s", err.Error())
 				}
-				return fmt.Errorf("IP在配置文件计数策略中被封禁, 时长 %d 秒。", r.BannedSeconds)
+				s.kickBanWatch()
+				return newCheckError(r.Action, fmt.Sprintf("IP在配置文件计数策略中被封禁, 时长 %d 秒。", r.BannedSeconds))
 			}
 		}
-	} else {
+	} else if len(countRules) == 0 {
 		// 默认策略：3分钟内5次以上, 封禁10分钟
 		limit := 10                              // +1防止TryCount是0
 		after := now.Add(-1 * time.Second * 180) // 三分钟
 
-		res, err := database.FindSshConnectRecord("", ip, to, limit, after)
+		res, err := database.FindSshConnectRecord(s.getConfig().Name, "", ip, limit, after)
 		if err != nil {
 			logger.Errorf("count rules check error: %s", err.Error())
 			return fmt.Errorf("从数据库读取SSH记录异常，禁止连接。")
@@ -634,10 +1238,11 @@ func (s *SshServer) countRulesCheck(ip net.IP, to *net.TCPAddr, countRules []*co
 
 		if len(res) > 5 {
 			// 命中默认策略
-			err := redisserver.SetSSHIpBanned(ip.String(), 600*time.Second)
+			err := redisserver.SetSSHIpBanned(ip.String(), 600*time.Second, "")
 			if err != nil {
 				logger.Errorf("count rules check error: %s", err.Error())
 			}
+			s.kickBanWatch()
 			return fmt.Errorf("IP在配置文件计数策略中被封禁, 时长 %d 秒。", 600)
 		}
 	}
@@ -659,7 +1264,23 @@ func (*SshServer) _countRulesCheck(record []database.SshConnectRecord, rules *co
 	return len(record)-index > int(rules.TryCount) // 返回是否命中策略，true表示命中 (使用大于, 而不是大于等于)
 }
 
-func (s *SshServer) addSshConnectRecord(fromIP net.IP, to *net.TCPAddr, loc *apiip.QueryIpLocationData, accept bool, now time.Time, mark string) (*database.SshConnectRecord, error) {
+func (s *SshServer) _transferRulesCheck(ip net.IP, rules *config.SshCountRuleConfig, now time.Time) bool {
+	if rules.TransferBytesLimit <= 0 {
+		return false
+	}
+
+	after := now.Add(-1 * time.Second * time.Duration(rules.Seconds))
+
+	total, err := database.SumSshConnectRecordBytes(s.getConfig().Name, ip, after)
+	if err != nil {
+		logger.Errorf("transfer rules check error: %s", err.Error())
+		return false
+	}
+
+	return total > rules.TransferBytesLimit // 返回是否命中策略，true表示命中
+}
+
+func (s *SshServer) addSshConnectRecord(fromIP net.IP, peer string, to string, loc *apiip.QueryIpLocationData, clientVersion string, accept bool, now time.Time, mark string) (*database.SshConnectRecord, error) {
 	var err error
 
 	if loc == nil {
@@ -673,21 +1294,21 @@ func (s *SshServer) addSshConnectRecord(fromIP net.IP, to *net.TCPAddr, loc *api
 		}
 	}
 
-	record, err := database.AddSshConnectRecord("", fromIP, loc, to, accept, now, mark)
+	record, err := database.AddSshConnectRecord(s.getConfig().Name, "", fromIP, peer, loc, clientVersion, to, accept, now, mark)
 	if err != nil {
 		return nil, err
 	}
 
 	if accept {
-		notify.SendSshSuccess(record.From, loc, record.To, record.Mark)
+		notify.SendSshSuccess(s.getConfig().Name, record.From, loc, record.To, record.Mark)
 	} else {
-		notify.SendSshBanned(record.From, loc, record.To, record.Mark)
+		notify.SendSshBanned(s.getConfig().Name, record.From, loc, record.To, record.Mark)
 	}
 
 	return record, nil
 }
 
-func (s *SshServer) addSshConnectRecordNotSend(fromIP net.IP, to *net.TCPAddr, loc *apiip.QueryIpLocationData, accept bool, now time.Time, mark string) (*database.SshConnectRecord, error) {
+func (s *SshServer) addSshConnectRecordNotSend(fromIP net.IP, peer string, to string, loc *apiip.QueryIpLocationData, clientVersion string, accept bool, now time.Time, mark string) (*database.SshConnectRecord, error) {
 	var err error
 
 	if loc == nil {
@@ -701,7 +1322,7 @@ func (s *SshServer) addSshConnectRecordNotSend(fromIP net.IP, to *net.TCPAddr, l
 		}
 	}
 
-	record, err := database.AddSshConnectRecord("", fromIP, loc, to, accept, now, mark)
+	record, err := database.AddSshConnectRecord(s.getConfig().Name, "", fromIP, peer, loc, clientVersion, to, accept, now, mark)
 	if err != nil {
 		return nil, err
 	}
@@ -709,10 +1330,70 @@ func (s *SshServer) addSshConnectRecordNotSend(fromIP net.IP, to *net.TCPAddr, l
 	return record, nil
 }
 
+// rejectSshConnectRecord 已保存为允许的连接记录在转发前失败，改为拒绝并发送通知
+func (s *SshServer) rejectSshConnectRecord(record *database.SshConnectRecord, loc *apiip.QueryIpLocationData, mark string) {
+	err := database.RejectSshConnectRecord(record, mark)
+	if err != nil {
+		logger.Errorf("update ssh connect record error: %s", err.Error())
+	}
+
+	notify.SendSshBanned(s.getConfig().Name, record.From, loc, record.To, record.Mark)
+}
+
 func (s *SshServer) isSSHRequests(headerData []byte) bool {
-	if s.config.HeaderCheck.IsDisable(false) {
+	if s.getConfig().HeaderCheck.IsDisable(false) {
 		return true
 	}
 
-	return strings.HasPrefix(string(headerData), s.config.Header)
+	return strings.HasPrefix(string(headerData), s.getConfig().Header)
+}
+
+// dialBackend 按照回源策略依次连接回源地址，deadline 为判定时限，零值表示不限制；ctx 被取消时（服务停止）立即放弃。
+// retrying 为 true 时（hold 期间的重试）不再记录每次失败的日志。
+func (s *SshServer) dialBackend(ctx context.Context, pool *backendPool, ip net.IP, deadline time.Time, retrying bool) (net.Conn, *backend, string, error) {
+	var mark = ""
+	var lastErr error = fmt.Errorf("no backend")
+
+	dialer := net.Dialer{
+		Timeout:  s.getConfig().DialTimeoutDuration,
+		Deadline: deadline,
+	}
+
+	for _, b := range pool.candidates(ip) {
+		target, err := dialer.DialContext(ctx, b.network, b.addr.String())
+		if err != nil && ctx.Err() != nil { // 服务停止，不是回源地址的问题
+			return nil, nil, mark, err
+		} else if err != nil && !deadline.IsZero() && !time.Now().Before(deadline) { // 超过判定时限，不是回源地址的问题
+			mark += fmt.Sprintf("回源地址 %s 连接超时。", b.address)
+			return nil, nil, mark, err
+		} else if err != nil {
+			if !retrying {
+				logger.Errorf("forward %s failed to connect to target %s: %v", s.getConfig().Name, b.address, err)
+			}
+			pool.dialFailed(b, err)
+			mark += dialFailedMark(b.address, err)
+			lastErr = err
+			continue
+		}
+
+		return target, b, mark, nil
+	}
+
+	return nil, nil, mark, lastErr
+}
+
+// dialFailedMark 连接回源地址失败的备注，区分拒绝连接（dial-refused）和连接超时（dial-timeout）
+func dialFailedMark(address string, err error) string {
+	var netErr net.Error
+	if errors.Is(err, syscall.ECONNREFUSED) {
+		return fmt.Sprintf("回源地址 %s 拒绝连接（dial-refused）。", address)
+	} else if errors.As(err, &netErr) && netErr.Timeout() {
+		return fmt.Sprintf("回源地址 %s 连接超时（dial-timeout）。", address)
+	}
+
+	return fmt.Sprintf("回源地址 %s 连接失败（%s）。", address, err.Error())
+}
+
+func isSameFamily(a net.IP, b net.IP) bool {
+	return (a.To4() == nil) == (b.To4() == nil)
 }
@@ -0,0 +1,267 @@
+package sshserver
+
+import (
+	"fmt"
+	"github.com/SongZihuan/ssh-watcher/src/api/apiip"
+	"github.com/SongZihuan/ssh-watcher/src/database"
+	"github.com/pires/go-proxyproto"
+	"io"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// sessionEnd 会话结束的原因
+type sessionEnd struct {
+	cause  string // 分类，见 database.Disconnect* 常量
+	reason string // 写入数据库记录备注的说明
+}
+
+// session 一个已经建立转发的SSH连接
+type session struct {
+	remoteAddr string
+	ip         net.IP
+	loc        *apiip.QueryIpLocationData
+
+	conn    net.Conn
+	target  net.Conn
+	backend *backend
+
+	lock   sync.Mutex                 // 保护 record：指纹和结束时的更新在转发的 goroutine 中进行，管理接口和 ban-watch 同时读取
+	record *database.SshConnectRecord // 通过 recordCopy 读取，通过 updateRecord 修改
+
+	limitKey  *sessionLimitKey  // 会话结束时释放并发会话名额
+	bandwidth *sessionBandwidth // 会话结束时释放共享的令牌桶
+
+	protocol string // 按协议分流时识别的协议，未启用时为 ssh
+
+	upload     atomic.Int64 // 客户端 -> 回源地址 的字节数
+	download   atomic.Int64 // 回源地址 -> 客户端 的字节数
+	lastActive atomic.Int64 // 最后一次收到数据的时间（UnixNano）
+
+	reason atomic.Pointer[sessionEnd] // 主动断开的原因，为 nil 表示未被主动断开
+	ended  atomic.Pointer[sessionEnd] // 第一个结束的方向（对端断开或出错），主动断开时以 reason 为准
+
+	hassh    atomic.Pointer[string] // 客户端的 HASSH 指纹，获取到之前为 nil
+	banAlert atomic.Pointer[string] // 来源被封禁但未断开（ban-watch 为 alert）时的说明，会话结束时写入备注
+
+	done     chan bool // 会话结束（或被主动断开）时关闭
+	doneOnce sync.Once
+}
+
+func newSession(remoteAddr string, ip net.IP, loc *apiip.QueryIpLocationData, conn net.Conn, target net.Conn, b *backend, record *database.SshConnectRecord, limitKey *sessionLimitKey, bandwidth *sessionBandwidth) *session {
+	res := &session{
+		remoteAddr: remoteAddr,
+		ip:         ip,
+		loc:        loc,
+		conn:       conn,
+		target:     target,
+		backend:    b,
+		record:     record,
+		limitKey:   limitKey,
+		bandwidth:  bandwidth,
+		done:       make(chan bool),
+	}
+
+	res.touch()
+
+	return res
+}
+
+// String 会话的描述，用于日志和停止时的消息推送
+func (sess *session) String() string {
+	record := sess.recordCopy()
+	duration := time.Since(record.Time).Truncate(time.Second)
+
+	if sess.loc == nil {
+		return fmt.Sprintf("IP %s （无定位信息） 连接到 %s，已持续 %s", sess.ip.String(), record.To, duration.String())
+	}
+
+	return fmt.Sprintf("IP %s （%s） 连接到 %s，已持续 %s", sess.ip.String(), sess.loc.String(), record.To, duration.String())
+}
+
+// recordCopy 连接记录的副本
+func (sess *session) recordCopy() database.SshConnectRecord {
+	sess.lock.Lock()
+	defer sess.lock.Unlock()
+
+	return *sess.record
+}
+
+// updateRecord 持有会话锁修改（并保存）连接记录
+func (sess *session) updateRecord(update func(record *database.SshConnectRecord) error) error {
+	sess.lock.Lock()
+	defer sess.lock.Unlock()
+
+	return update(sess.record)
+}
+
+func (sess *session) touch() {
+	sess.lastActive.Store(time.Now().UnixNano())
+}
+
+// close 主动断开会话，只有第一次调用的原因会被记录
+func (sess *session) close(cause string, reason string) bool {
+	if !sess.reason.CompareAndSwap(nil, &sessionEnd{cause: cause, reason: reason}) {
+		return false
+	}
+
+	sess.finish()
+	_ = sess.conn.Close()
+	_ = sess.target.Close()
+	return true
+}
+
+// finish 通知会话相关的 goroutine 退出
+func (sess *session) finish() {
+	sess.doneOnce.Do(func() {
+		close(sess.done)
+	})
+}
+
+// isFinished 会话是否已经结束，结束后连接会被关闭，转发时的错误无需记录
+func (sess *session) isFinished() bool {
+	select {
+	case <-sess.done:
+		return true
+	default:
+		return false
+	}
+}
+
+func (sess *session) isClosed() bool {
+	return sess.reason.Load() != nil
+}
+
+// end 记录一个方向结束的原因（对端断开或出错），只有第一次调用的原因会被记录
+func (sess *session) end(cause string, reason string) {
+	sess.ended.CompareAndSwap(nil, &sessionEnd{cause: cause, reason: reason})
+}
+
+// closeReason 会话结束的原因：优先使用主动断开的原因，其次是第一个结束的方向
+func (sess *session) closeReason() (cause string, reason string) {
+	end := sess.reason.Load()
+	if end == nil {
+		end = sess.ended.Load()
+	}
+
+	if end == nil {
+		return database.DisconnectClient, "连接正常断开。"
+	}
+
+	return end.cause, end.reason
+}
+
+// copy 与 io.Copy 类似，额外记录字节数和最后活跃时间，并按照 limiters 限速，tap 在写入前读取数据（可以为 nil）
+func (sess *session) copy(dst net.Conn, src net.Conn, counter *atomic.Int64, limiters []*rateLimiter, tap func(p []byte)) (written int64, err error) {
+	buf := make([]byte, bufferSize(limiters))
+
+	for {
+		nr, er := src.Read(buf)
+		if nr > 0 {
+			sess.touch()
+
+			if len(limiters) > 0 && !wait(limiters, nr, sess.done) {
+				return written, nil // 会话已经结束
+			}
+
+			if tap != nil {
+				tap(buf[:nr])
+				if sess.isClosed() {
+					return written, nil // tap 中断开了会话
+				}
+			}
+
+			nw, ew := dst.Write(buf[:nr])
+			if nw < 0 || nr < nw {
+				nw = 0
+				if ew == nil {
+					ew = io.ErrShortWrite
+				}
+			}
+
+			written += int64(nw)
+			counter.Add(int64(nw))
+
+			if ew != nil {
+				return written, ew
+			}
+
+			if nr != nw {
+				return written, io.ErrShortWrite
+			}
+		}
+
+		if er != nil {
+			if er != io.EOF {
+				return written, er
+			}
+			return written, nil
+		}
+	}
+}
+
+func (sess *session) getHASSH() string {
+	hassh := sess.hassh.Load()
+	if hassh == nil {
+		return ""
+	}
+
+	return *hassh
+}
+
+// closeWrite 关闭连接的写入方向（半关闭），对端会读到 EOF，连接不支持半关闭时返回错误
+func closeWrite(conn net.Conn) error {
+	if pconn, ok := conn.(*proxyproto.Conn); ok {
+		conn = pconn.Raw()
+	}
+
+	cw, ok := conn.(interface{ CloseWrite() error })
+	if !ok {
+		return fmt.Errorf("half-close is not supported by %T", conn)
+	}
+
+	return cw.CloseWrite()
+}
+
+// watch 检查空闲超时和最长会话时长，直到会话结束
+func (sess *session) watch(idle time.Duration, maxTime time.Duration) {
+	if idle <= 0 && maxTime <= 0 {
+		return
+	}
+
+	var idleTimer *time.Timer
+	var idleChan <-chan time.Time
+	var maxChan <-chan time.Time
+
+	if idle > 0 {
+		idleTimer = time.NewTimer(idle)
+		defer idleTimer.Stop()
+		idleChan = idleTimer.C
+	}
+
+	if maxTime > 0 {
+		maxTimer := time.NewTimer(maxTime)
+		defer maxTimer.Stop()
+		maxChan = maxTimer.C
+	}
+
+	for {
+		select {
+		case <-sess.done:
+			return
+		case <-maxChan:
+			sess.close(database.DisconnectTimeout, fmt.Sprintf("会话达到最长时长（%s），连接被断开。", maxTime.String()))
+			return
+		case <-idleChan:
+			remain := idle - time.Since(time.Unix(0, sess.lastActive.Load()))
+			if remain <= 0 {
+				sess.close(database.DisconnectTimeout, fmt.Sprintf("会话空闲超时（%s），连接被断开。", idle.String()))
+				return
+			}
+
+			idleTimer.Reset(remain)
+		}
+	}
+}
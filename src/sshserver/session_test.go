@@ -0,0 +1,113 @@
+package sshserver
+
+import (
+	"database/sql"
+	"fmt"
+	"github.com/SongZihuan/ssh-watcher/src/database"
+	"net"
+	"sync"
+	"testing"
+	"time"
+)
+
+func newTestSession(t *testing.T) *session {
+	conn, peer := net.Pipe()
+	target, upstream := net.Pipe()
+	t.Cleanup(func() {
+		_ = conn.Close()
+		_ = peer.Close()
+		_ = target.Close()
+		_ = upstream.Close()
+	})
+
+	record := &database.SshConnectRecord{
+		From: "127.0.0.1",
+		To:   "127.0.0.1:22",
+		Time: time.Now(),
+	}
+	record.ID = 1
+
+	return newSession("127.0.0.1:50000", net.IPv4(127, 0, 0, 1), nil, conn, target, nil, record, nil, nil)
+}
+
+// TestSessionRecordConcurrent 指纹更新（转发的 goroutine）与管理接口、ban-watch 的读取同时进行，需使用 -race 运行
+func TestSessionRecordConcurrent(t *testing.T) {
+	sess := newTestSession(t)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(2)
+
+		go func(i int) {
+			defer wg.Done()
+
+			for j := 0; j < 100; j++ {
+				_ = sess.updateRecord(func(record *database.SshConnectRecord) error {
+					record.HASSH = sql.NullString{Valid: true, String: fmt.Sprintf("%d-%d", i, j)}
+					record.Mark = record.HASSH.String
+					return nil
+				})
+			}
+		}(i)
+
+		go func() {
+			defer wg.Done()
+
+			for j := 0; j < 100; j++ {
+				_ = sess.String()
+				_ = sess.recordCopy().HASSH.String
+			}
+		}()
+	}
+
+	wg.Wait()
+
+	if !sess.recordCopy().HASSH.Valid {
+		t.Fatalf("hassh is not saved")
+	}
+}
+
+// TestSessionInfoWhileClosing 管理接口读取会话和断开会话与会话结束时保存记录同时进行，需使用 -race 运行
+func TestSessionInfoWhileClosing(t *testing.T) {
+	sess := newTestSession(t)
+
+	var wg sync.WaitGroup
+	wg.Add(3)
+
+	go func() {
+		defer wg.Done()
+
+		for j := 0; j < 100; j++ {
+			info := sess.info("test")
+			if info.ID != 1 {
+				t.Errorf("bad session id %d", info.ID)
+				return
+			}
+		}
+	}()
+
+	go func() {
+		defer wg.Done()
+
+		sess.close(database.DisconnectKilled, "会话被管理员断开。")
+	}()
+
+	go func() {
+		defer wg.Done()
+
+		sess.end(database.DisconnectClient, "客户端断开连接。")
+		cause, reason := sess.closeReason()
+		_ = sess.updateRecord(func(record *database.SshConnectRecord) error {
+			record.DisconnectCause = sql.NullString{Valid: true, String: cause}
+			record.Mark = reason
+			return nil
+		})
+	}()
+
+	wg.Wait()
+
+	cause, _ := sess.closeReason()
+	if cause != database.DisconnectKilled && cause != database.DisconnectClient {
+		t.Fatalf("bad disconnect cause %s", cause)
+	}
+}
@@ -0,0 +1,44 @@
+package sshserver
+
+import (
+	"github.com/SongZihuan/ssh-watcher/src/config"
+	"github.com/pires/go-proxyproto"
+	"net"
+)
+
+func tcpConnOf(conn net.Conn) (*net.TCPConn, bool) {
+	switch c := conn.(type) {
+	case *net.TCPConn:
+		return c, true
+	case *proxyproto.Conn:
+		return c.TCPConn()
+	default:
+		return nil, false
+	}
+}
+
+// setSocketOptions 按照转发配置设定 TCP keepalive 和 TCP_USER_TIMEOUT
+func setSocketOptions(conn net.Conn, cfg *config.SshSessionConfig) error {
+	tcpConn, ok := tcpConnOf(conn)
+	if !ok {
+		return nil
+	}
+
+	if cfg.TCPKeepAlive.IsDisable(false) {
+		return tcpConn.SetKeepAlive(false)
+	}
+
+	err := tcpConn.SetKeepAlive(true)
+	if err != nil {
+		return err
+	}
+
+	if cfg.TCPKeepAliveIdleDuration > 0 {
+		err = tcpConn.SetKeepAlivePeriod(cfg.TCPKeepAliveIdleDuration) // 同时会设置探测间隔，后续再单独设置
+		if err != nil {
+			return err
+		}
+	}
+
+	return setPlatformSocketOptions(tcpConn, cfg)
+}
@@ -0,0 +1,49 @@
+//go:build linux
+
+package sshserver
+
+import (
+	"github.com/SongZihuan/ssh-watcher/src/config"
+	"golang.org/x/sys/unix"
+	"net"
+)
+
+func setPlatformSocketOptions(tcpConn *net.TCPConn, cfg *config.SshSessionConfig) error {
+	if cfg.TCPKeepAliveIntervalDuration <= 0 && cfg.TCPKeepAliveCount <= 0 && cfg.TCPUserTimeoutDuration <= 0 {
+		return nil
+	}
+
+	rawConn, err := tcpConn.SyscallConn()
+	if err != nil {
+		return err
+	}
+
+	var sockErr error
+	err = rawConn.Control(func(fd uintptr) {
+		if cfg.TCPKeepAliveIntervalDuration > 0 {
+			sockErr = unix.SetsockoptInt(int(fd), unix.IPPROTO_TCP, unix.TCP_KEEPINTVL, int(cfg.TCPKeepAliveIntervalDuration.Seconds()))
+			if sockErr != nil {
+				return
+			}
+		}
+
+		if cfg.TCPKeepAliveCount > 0 {
+			sockErr = unix.SetsockoptInt(int(fd), unix.IPPROTO_TCP, unix.TCP_KEEPCNT, int(cfg.TCPKeepAliveCount))
+			if sockErr != nil {
+				return
+			}
+		}
+
+		if cfg.TCPUserTimeoutDuration > 0 {
+			sockErr = unix.SetsockoptInt(int(fd), unix.IPPROTO_TCP, unix.TCP_USER_TIMEOUT, int(cfg.TCPUserTimeoutDuration.Milliseconds()))
+			if sockErr != nil {
+				return
+			}
+		}
+	})
+	if err != nil {
+		return err
+	}
+
+	return sockErr
+}
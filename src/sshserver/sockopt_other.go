@@ -0,0 +1,17 @@
+//go:build !linux
+
+package sshserver
+
+import (
+	"github.com/SongZihuan/ssh-watcher/src/config"
+	"github.com/SongZihuan/ssh-watcher/src/logger"
+	"net"
+)
+
+func setPlatformSocketOptions(tcpConn *net.TCPConn, cfg *config.SshSessionConfig) error {
+	if cfg.TCPKeepAliveIntervalDuration > 0 || cfg.TCPKeepAliveCount > 0 || cfg.TCPUserTimeoutDuration > 0 {
+		logger.Debugf("tcp-keepalive-interval, tcp-keepalive-count and tcp-user-timeout are only supported on linux")
+	}
+
+	return nil
+}
@@ -0,0 +1,61 @@
+package sshserver
+
+import (
+	"errors"
+	"fmt"
+	"github.com/SongZihuan/ssh-watcher/src/config"
+	"github.com/pires/go-proxyproto"
+	"net"
+	"time"
+)
+
+const srcProxyHeaderTimeout = 5 * time.Second // 与读取SSH协议头部的超时相同
+
+// srcProxyConn 按照套接字对端地址的信任策略读取 Proxy 协议头部，返回包装后的连接，读取头部不会超过判定时限 deadline。
+// 返回的错误说明拒绝连接的原因，此时连接需要由调用者关闭。
+func (s *SshServer) srcProxyConn(conn net.Conn, deadline time.Time) (net.Conn, error) {
+	peer, ok := conn.RemoteAddr().(*net.TCPAddr)
+	if !ok {
+		return nil, fmt.Errorf("来源地址不是TCP地址")
+	}
+
+	var policy proxyproto.Policy
+	switch s.getConfig().SrcProxy.Mode(peer.IP) {
+	case config.SrcProxyModeDeny:
+		return nil, fmt.Errorf("来源 %s 不是可信的Proxy协议上游，不允许连接", peer.IP.String())
+	case config.SrcProxyModeRequire:
+		policy = proxyproto.REQUIRE
+	case config.SrcProxyModeReject:
+		policy = proxyproto.REJECT
+	default:
+		policy = proxyproto.USE
+	}
+
+	timeout := time.Until(earlier(srcProxyHeaderTimeout, deadline))
+	if timeout <= 0 {
+		return nil, fmt.Errorf("读取Proxy协议头部前已超时")
+	}
+
+	pconn := proxyproto.NewConn(conn, proxyproto.WithPolicy(policy), proxyproto.SetReadHeaderTimeout(timeout))
+
+	// 长度为 0 的读取只会读取 Proxy 协议头部，不会等待之后的数据，并返回读取头部时的错误
+	_, err := pconn.Read(nil)
+	if errors.Is(err, proxyproto.ErrNoProxyProtocol) {
+		return nil, fmt.Errorf("来源 %s 必须发送Proxy协议头部", peer.IP.String())
+	} else if errors.Is(err, proxyproto.ErrSuperfluousProxyHeader) {
+		return nil, fmt.Errorf("来源 %s 不是可信的Proxy协议上游，不允许发送Proxy协议头部", peer.IP.String())
+	} else if err != nil {
+		return nil, fmt.Errorf("读取Proxy协议头部错误：%s", err.Error())
+	}
+
+	return pconn, nil
+}
+
+// peerAddress 套接字的对端地址，不受 Proxy 协议头部影响
+func peerAddress(conn net.Conn) string {
+	if c, ok := conn.(*proxyproto.Conn); ok {
+		return c.Raw().RemoteAddr().String()
+	}
+
+	return conn.RemoteAddr().String()
+}
@@ -10,4 +10,5 @@ const (
 	StatusRunning
 	StatusStopping
 	StatusFinished
+	StatusRetired // 重载配置后已关闭监听，只等待已有的会话结束
 )
@@ -0,0 +1,196 @@
+package sshserver
+
+import (
+	"errors"
+	"fmt"
+	"github.com/SongZihuan/ssh-watcher/src/api/apiip"
+	"github.com/SongZihuan/ssh-watcher/src/config"
+	"github.com/SongZihuan/ssh-watcher/src/database"
+	"github.com/SongZihuan/ssh-watcher/src/logger"
+	"io"
+	"math/rand"
+	"net"
+	"sync/atomic"
+	"time"
+)
+
+const tarpitChars = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
+
+var tarpitSockets atomic.Int64 // 所有转发正在拖延的连接数
+
+// checkError 来访检查未通过的原因，action 表示对该连接的处理方式
+type checkError struct {
+	msg    string
+	action string
+	notice string // 断开前发送给客户端的提示信息（仅 action 为 reject 时），为空表示直接断开
+}
+
+func newCheckError(action string, msg string) error {
+	return &checkError{
+		msg:    msg,
+		action: action,
+	}
+}
+
+func (e *checkError) Error() string {
+	return e.msg
+}
+
+// newRejectError 检查未通过，断开前向客户端发送提示信息 notice
+func newRejectError(action string, msg string, notice string) error {
+	return &checkError{
+		msg:    msg,
+		action: action,
+		notice: notice,
+	}
+}
+
+// checkNotice 返回检查未通过时需要发送给客户端的提示信息
+func checkNotice(err error) string {
+	var ckErr *checkError
+	if errors.As(err, &ckErr) && ckErr.action == config.ActionReject {
+		return ckErr.notice
+	}
+
+	return ""
+}
+
+// checkAction 返回检查未通过时对连接的处理方式，默认为立即断开
+func checkAction(err error) string {
+	var ckErr *checkError
+	if errors.As(err, &ckErr) {
+		return ckErr.action
+	}
+
+	return config.ActionReject
+}
+
+// startTarpit 记录并开始拖延连接，返回 false 表示拖延的连接数已达上限（连接需要由调用者断开）
+func (s *SshServer) startTarpit(conn net.Conn, ip net.IP, to string, loc *apiip.QueryIpLocationData, clientVersion string, now time.Time, mark string) bool {
+	cfg := &config.GetConfig().SSH.Tarpit
+
+	if tarpitSockets.Add(1) > cfg.MaxSockets {
+		tarpitSockets.Add(-1)
+		_, _ = s.addSshConnectRecord(ip, peerAddress(conn), to, loc, clientVersion, false, now, mark+"拖延的连接数已达上限，直接断开。")
+		return false
+	}
+
+	record, err := s.addSshConnectRecord(ip, peerAddress(conn), to, loc, clientVersion, false, now, mark+"连接被拖延（tarpit）。")
+	if err != nil {
+		logger.Errorf("Fail to save ssh connect record to database: %s", err.Error())
+	}
+
+	s.swg.Add(1)
+	go s.tarpit(conn, ip, record, cfg)
+
+	return true
+}
+
+// tarpit 保持连接，每隔一段时间发送一行随机内容（SSH标识行前允许出现的其他行），直到客户端断开、达到最长时长或服务停止
+func (s *SshServer) tarpit(conn net.Conn, ip net.IP, record *database.SshConnectRecord, cfg *config.SshTarpitConfig) {
+	defer s.swg.Done()
+	defer tarpitSockets.Add(-1)
+
+	defer func() {
+		if r := recover(); r != nil {
+			logger.Panicf("forward %s tarpit panic: %v", s.getConfig().Name, r)
+		}
+	}()
+
+	start := time.Now()
+
+	var closechan = make(chan bool)
+	go func() {
+		defer close(closechan)
+		_, _ = io.Copy(io.Discard, conn) // 丢弃客户端发送的数据，直到客户端断开
+	}()
+
+	go func() {
+		select {
+		case <-s.stopchan:
+			_ = conn.Close() // 服务停止时立即断开，正在进行的写入会返回错误
+		case <-closechan:
+		}
+	}()
+
+	var maxChan <-chan time.Time
+	if cfg.MaxDurationDuration > 0 {
+		maxTimer := time.NewTimer(cfg.MaxDurationDuration)
+		defer maxTimer.Stop()
+		maxChan = maxTimer.C
+	}
+
+	ticker := time.NewTicker(cfg.IntervalDuration)
+	defer ticker.Stop()
+
+	var sent int64
+	var cause string
+	var reason string
+
+MainCycle:
+	for {
+		select {
+		case <-s.stopchan:
+			cause = database.DisconnectShutdown
+			reason = "服务停止"
+			break MainCycle
+		case <-closechan:
+			cause = database.DisconnectClient
+			reason = "客户端断开"
+			break MainCycle
+		case <-maxChan:
+			cause = database.DisconnectTimeout
+			reason = "达到最长拖延时长"
+			break MainCycle
+		case <-ticker.C:
+			_ = conn.SetWriteDeadline(time.Now().Add(cfg.IntervalDuration)) // 客户端不读取数据时写入会阻塞，不能影响停止和最长拖延时长
+			n, err := conn.Write(tarpitLine(cfg.LineLength))
+			sent += int64(n)
+
+			var netErr net.Error
+			if err != nil && errors.As(err, &netErr) && netErr.Timeout() {
+				continue // 客户端的接收缓冲区已满，继续拖延
+			} else if err != nil {
+				cause = database.DisconnectClient
+				reason = "客户端断开"
+				break MainCycle
+			}
+		}
+	}
+
+	select {
+	case <-s.stopchan: // 服务停止时连接已被关闭，写入和读取的错误不是客户端断开造成的
+		cause = database.DisconnectShutdown
+		reason = "服务停止"
+	default:
+	}
+
+	_ = conn.Close()
+	<-closechan
+
+	duration := time.Since(start)
+
+	if record != nil {
+		err := database.UpdateSshConnectRecord(record, 0, sent, cause, fmt.Sprintf("拖延 %s 后%s。", duration.Truncate(time.Second).String(), reason))
+		if err != nil {
+			logger.Errorf("update ssh connect record error: %s", err.Error())
+		}
+	}
+
+	err := database.AddSshTarpitStat(ip.String(), duration)
+	if err != nil {
+		logger.Errorf("add ssh tarpit stat error: %s", err.Error())
+	}
+}
+
+// tarpitLine 生成一行随机内容，不会以 SSH- 开头
+func tarpitLine(maxLength int64) []byte {
+	n := 3 + rand.Int63n(maxLength-2)
+	res := make([]byte, 0, n+2)
+
+	for i := int64(0); i < n; i++ {
+		res = append(res, tarpitChars[rand.Intn(len(tarpitChars))])
+	}
+
+	return append(res, '\r', '\n')
+}
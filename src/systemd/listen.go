@@ -0,0 +1,99 @@
+package systemd
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+)
+
+const listenFdsStart = 3 // SD_LISTEN_FDS_START
+
+// Listeners 读取 systemd 套接字激活传入的监听（LISTEN_PID、LISTEN_FDS 和 LISTEN_FDNAMES），按名称分组返回。
+// 读取后会清除上述环境变量，避免子进程再次读取。未通过套接字激活启动时返回空表。
+func Listeners() (map[string][]net.Listener, error) {
+	defer unsetListenEnv()
+
+	res := make(map[string][]net.Listener, 4)
+
+	fds, err := listenFds()
+	if err != nil {
+		return nil, err
+	}
+
+	names := strings.Split(os.Getenv("LISTEN_FDNAMES"), ":")
+
+	for i := 0; i < fds; i++ {
+		name := "unknown" // 和 systemd 的默认名称相同
+		if i < len(names) && names[i] != "" {
+			name = names[i]
+		}
+
+		file := os.NewFile(uintptr(listenFdsStart+i), name)
+
+		ln, err := net.FileListener(file) // 会复制文件描述符
+		_ = file.Close()
+		if err != nil {
+			closeListeners(res)
+			return nil, fmt.Errorf("fd %d (%s) is not a listener: %s", listenFdsStart+i, name, err.Error())
+		}
+
+		res[name] = append(res[name], ln)
+	}
+
+	return res, nil
+}
+
+// CloseListenFds 不使用套接字激活时，关闭 systemd 传入的文件描述符并清除环境变量，避免泄漏给升级时启动的新进程
+func CloseListenFds() {
+	defer unsetListenEnv()
+
+	fds, err := listenFds()
+	if err != nil {
+		return
+	}
+
+	for i := 0; i < fds; i++ {
+		_ = os.NewFile(uintptr(listenFdsStart+i), "").Close()
+	}
+}
+
+// listenFds 传给本进程的文件描述符数量，未通过套接字激活启动（或者是传给其他进程的）时返回 0
+func listenFds() (int, error) {
+	fdsStr := os.Getenv("LISTEN_FDS")
+	if fdsStr == "" {
+		return 0, nil
+	}
+
+	pidStr := os.Getenv("LISTEN_PID")
+	if pidStr != "" {
+		pid, err := strconv.Atoi(pidStr)
+		if err != nil {
+			return 0, fmt.Errorf("bad LISTEN_PID: %s", pidStr)
+		} else if pid != os.Getpid() {
+			return 0, nil // 不是传给本进程的
+		}
+	}
+
+	fds, err := strconv.Atoi(fdsStr)
+	if err != nil || fds < 0 {
+		return 0, fmt.Errorf("bad LISTEN_FDS: %s", fdsStr)
+	}
+
+	return fds, nil
+}
+
+func unsetListenEnv() {
+	_ = os.Unsetenv("LISTEN_PID")
+	_ = os.Unsetenv("LISTEN_FDS")
+	_ = os.Unsetenv("LISTEN_FDNAMES")
+}
+
+func closeListeners(listeners map[string][]net.Listener) {
+	for _, lns := range listeners {
+		for _, ln := range lns {
+			_ = ln.Close()
+		}
+	}
+}
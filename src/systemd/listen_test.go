@@ -0,0 +1,117 @@
+//go:build linux
+
+package systemd
+
+import (
+	"net"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"syscall"
+	"testing"
+)
+
+// 由 runListenHelper 在子进程中运行，systemd 传入的文件描述符从 3 开始
+func TestListenHelper(t *testing.T) {
+	mode := os.Getenv("SYSTEMD_TEST_HELPER")
+	if mode == "" {
+		t.Skip("helper process only")
+	}
+
+	switch mode {
+	case "listeners":
+		listeners, err := Listeners()
+		if err != nil {
+			t.Fatalf("listeners: %s", err.Error())
+		}
+
+		if os.Getenv("LISTEN_FDS") != "" || os.Getenv("LISTEN_PID") != "" || os.Getenv("LISTEN_FDNAMES") != "" {
+			t.Fatalf("listen environment is not unset")
+		}
+
+		for _, name := range []string{"ssh", "@metrics"} {
+			if len(listeners[name]) != 1 {
+				t.Fatalf("listener %s count is %d, want 1", name, len(listeners[name]))
+			}
+
+			conn, err := net.Dial("tcp", listeners[name][0].Addr().String())
+			if err != nil {
+				t.Fatalf("dial listener %s: %s", name, err.Error())
+			}
+			_ = conn.Close()
+
+			_, _ = listeners[name][0].Accept()
+		}
+	case "close":
+		CloseListenFds()
+
+		if os.Getenv("LISTEN_FDS") != "" || os.Getenv("LISTEN_PID") != "" || os.Getenv("LISTEN_FDNAMES") != "" {
+			t.Fatalf("listen environment is not unset")
+		}
+
+		for fd := listenFdsStart; fd < listenFdsStart+2; fd++ {
+			if _, err := syscall.Getsockname(fd); err == nil {
+				t.Fatalf("fd %d is still open", fd)
+			}
+		}
+	}
+}
+
+// runListenHelper 以 systemd 套接字激活的方式启动子进程（传入两个 TCP 监听），env 为额外的环境变量
+func runListenHelper(t *testing.T, mode string, env ...string) {
+	files := make([]*os.File, 0, 2)
+	for i := 0; i < 2; i++ {
+		ln, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatalf("listen: %s", err.Error())
+		}
+
+		file, err := ln.(*net.TCPListener).File()
+		_ = ln.Close()
+		if err != nil {
+			t.Fatalf("listener file: %s", err.Error())
+		}
+		defer func() {
+			_ = file.Close()
+		}()
+
+		files = append(files, file)
+	}
+
+	cmd := exec.Command(os.Args[0], "-test.run=^TestListenHelper$", "-test.v")
+	cmd.ExtraFiles = files
+	cmd.Env = append(os.Environ(), "SYSTEMD_TEST_HELPER="+mode, "LISTEN_FDS=2", "LISTEN_FDNAMES=ssh:@metrics")
+	cmd.Env = append(cmd.Env, env...)
+
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("helper %s failed: %s\n%s", mode, err.Error(), out)
+	} else if !strings.Contains(string(out), "--- PASS: TestListenHelper") {
+		t.Fatalf("helper %s did not run:\n%s", mode, out)
+	}
+}
+
+func TestListeners(t *testing.T) {
+	runListenHelper(t, "listeners")
+}
+
+func TestCloseListenFds(t *testing.T) {
+	runListenHelper(t, "close")
+}
+
+func TestListenersOtherPID(t *testing.T) {
+	t.Setenv("LISTEN_FDS", "2")
+	t.Setenv("LISTEN_PID", strconv.Itoa(os.Getpid()+1))
+
+	listeners, err := Listeners()
+	if err != nil {
+		t.Fatalf("listeners: %s", err.Error())
+	} else if len(listeners) != 0 {
+		t.Fatalf("listeners for other pid are used")
+	}
+
+	if os.Getenv("LISTEN_FDS") != "" {
+		t.Fatalf("listen environment is not unset")
+	}
+}
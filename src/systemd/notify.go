@@ -0,0 +1,68 @@
+package systemd
+
+import (
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	StateReady    = "READY=1"
+	StateStopping = "STOPPING=1"
+	StateWatchdog = "WATCHDOG=1"
+)
+
+// Notify 向 NOTIFY_SOCKET 发送状态（sd_notify），未由 systemd 启动时不做任何事
+func Notify(states ...string) error {
+	socket := os.Getenv("NOTIFY_SOCKET")
+	if socket == "" || len(states) == 0 {
+		return nil
+	}
+
+	// 以 @ 开头的抽象套接字由 net 包自动处理
+	conn, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: socket, Net: "unixgram"})
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = conn.Close()
+	}()
+
+	_, err = conn.Write([]byte(strings.Join(states, "\n")))
+	return err
+}
+
+// Status 生成 STATUS= 状态，systemctl status 中会显示该内容
+func Status(status string) string {
+	return "STATUS=" + strings.ReplaceAll(status, "\n", " ")
+}
+
+// MainPID 生成 MAINPID= 状态，升级后由旧进程告知 systemd 新进程的 PID（需要 NotifyAccess=all）
+func MainPID(pid int) string {
+	return "MAINPID=" + strconv.Itoa(pid)
+}
+
+// WatchdogInterval 读取 systemd 要求的看门狗间隔（WATCHDOG_USEC），未启用时返回 0
+func WatchdogInterval() time.Duration {
+	usecStr := os.Getenv("WATCHDOG_USEC")
+	if usecStr == "" {
+		return 0
+	}
+
+	pidStr := os.Getenv("WATCHDOG_PID")
+	if pidStr != "" {
+		pid, err := strconv.Atoi(pidStr)
+		if err != nil || pid != os.Getpid() {
+			return 0
+		}
+	}
+
+	usec, err := strconv.ParseInt(usecStr, 10, 64)
+	if err != nil || usec <= 0 {
+		return 0
+	}
+
+	return time.Duration(usec) * time.Microsecond
+}
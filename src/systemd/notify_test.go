@@ -0,0 +1,135 @@
+//go:build linux
+
+package systemd
+
+import (
+	"fmt"
+	"net"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// listenNotify 在临时目录中创建 unixgram 套接字并设置 NOTIFY_SOCKET
+func listenNotify(t *testing.T) *net.UnixConn {
+	addr := &net.UnixAddr{Name: filepath.Join(t.TempDir(), "notify.sock"), Net: "unixgram"}
+
+	conn, err := net.ListenUnixgram("unixgram", addr)
+	if err != nil {
+		t.Fatalf("listen notify socket: %s", err.Error())
+	}
+	t.Cleanup(func() {
+		_ = conn.Close()
+	})
+
+	t.Setenv("NOTIFY_SOCKET", addr.Name)
+	return conn
+}
+
+func readNotify(t *testing.T, conn *net.UnixConn, timeout time.Duration) (string, bool) {
+	_ = conn.SetReadDeadline(time.Now().Add(timeout))
+
+	buf := make([]byte, 1024)
+	n, err := conn.Read(buf)
+	if err != nil {
+		return "", false
+	}
+
+	return string(buf[:n]), true
+}
+
+func TestNotify(t *testing.T) {
+	conn := listenNotify(t)
+
+	err := Notify(StateReady, Status("listening\non 22"), MainPID(1234))
+	if err != nil {
+		t.Fatalf("notify: %s", err.Error())
+	}
+
+	msg, ok := readNotify(t, conn, time.Second)
+	if want := "READY=1\nSTATUS=listening on 22\nMAINPID=1234"; !ok || msg != want {
+		t.Fatalf("notify message is %q, want %q", msg, want)
+	}
+}
+
+func TestNotifyWithoutSocket(t *testing.T) {
+	t.Setenv("NOTIFY_SOCKET", "")
+
+	err := Notify(StateReady)
+	if err != nil {
+		t.Fatalf("notify without NOTIFY_SOCKET: %s", err.Error())
+	}
+}
+
+func TestWatchdogInterval(t *testing.T) {
+	t.Setenv("WATCHDOG_USEC", "3000000")
+	t.Setenv("WATCHDOG_PID", "")
+	if i := WatchdogInterval(); i != 3*time.Second {
+		t.Errorf("watchdog interval is %s, want 3s", i)
+	}
+
+	t.Setenv("WATCHDOG_PID", "1") // 不是本进程
+	if i := WatchdogInterval(); i != 0 {
+		t.Errorf("watchdog interval for other pid is %s, want 0", i)
+	}
+
+	t.Setenv("WATCHDOG_USEC", "")
+	if NewWatchdog(nil) != nil {
+		t.Errorf("watchdog is created without WATCHDOG_USEC")
+	}
+}
+
+func TestWatchdog(t *testing.T) {
+	conn := listenNotify(t)
+
+	t.Setenv("WATCHDOG_USEC", "200000") // 每 100ms 发送一次
+	t.Setenv("WATCHDOG_PID", "")
+
+	var healthy = make(chan bool, 1)
+	healthy <- true
+
+	watchdog := NewWatchdog(func() error {
+		ok := <-healthy
+		healthy <- ok
+		if !ok {
+			return fmt.Errorf("unhealthy")
+		}
+		return nil
+	})
+	if watchdog == nil {
+		t.Fatalf("watchdog is not created")
+	}
+
+	err := watchdog.Start()
+	if err != nil {
+		t.Fatalf("start watchdog: %s", err.Error())
+	}
+	defer func() {
+		_ = watchdog.Stop()
+	}()
+
+	for i := 0; i < 2; i++ {
+		msg, ok := readNotify(t, conn, time.Second)
+		if !ok || msg != StateWatchdog {
+			t.Fatalf("watchdog message is %q, want %q", msg, StateWatchdog)
+		}
+	}
+
+	<-healthy
+	healthy <- false
+
+	for { // 丢弃已经发送的消息
+		if _, ok := readNotify(t, conn, 150*time.Millisecond); !ok {
+			break
+		}
+	}
+
+	if msg, ok := readNotify(t, conn, 400*time.Millisecond); ok {
+		t.Fatalf("watchdog is sent while unhealthy: %q", msg)
+	}
+
+	_ = watchdog.Stop()
+	if _, ok := readNotify(t, conn, 300*time.Millisecond); ok {
+		t.Fatalf("watchdog is sent after stop")
+	}
+}
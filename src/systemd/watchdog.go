@@ -0,0 +1,119 @@
+package systemd
+
+import (
+	"fmt"
+	"github.com/SongZihuan/ssh-watcher/src/logger"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	StatusReady int32 = iota
+	StatusRunning
+	StatusStopping
+	StatusFinished
+)
+
+// Watchdog 按照 WATCHDOG_USEC 的一半定期发送 WATCHDOG=1，check 返回错误时跳过本次发送，由 systemd 判定服务异常
+type Watchdog struct {
+	status   atomic.Int32
+	interval time.Duration
+	check    func() error
+	stopchan chan bool
+	swg      sync.WaitGroup
+}
+
+// NewWatchdog 未启用 systemd 看门狗时返回 nil
+func NewWatchdog(check func() error) *Watchdog {
+	interval := WatchdogInterval()
+	if interval <= 0 {
+		return nil
+	}
+
+	res := &Watchdog{
+		interval: interval,
+		check:    check,
+		stopchan: make(chan bool),
+	}
+
+	res.status.Store(StatusReady)
+
+	return res
+}
+
+// Interval systemd 要求的看门狗间隔
+func (w *Watchdog) Interval() time.Duration {
+	return w.interval
+}
+
+func (w *Watchdog) Start() error {
+	if w.status.Load() != StatusReady {
+		return nil
+	}
+
+	w.swg.Add(1)
+	go func() {
+		defer w.swg.Done()
+
+		defer func() {
+			r := recover()
+			if r != nil {
+				if err, ok := r.(error); ok {
+					logger.Panicf("Systemd watchdog panic error: %s", err.Error())
+				} else {
+					logger.Panicf("Systemd watchdog panic: %v", r)
+				}
+			}
+		}()
+
+		ticker := time.NewTicker(w.interval / 2)
+		defer ticker.Stop()
+
+	MainCycle:
+		for {
+			w.ping()
+
+			select {
+			case <-w.stopchan:
+				break MainCycle
+			case <-ticker.C:
+				// pass
+			}
+		}
+	}()
+
+	if !w.status.CompareAndSwap(StatusReady, StatusRunning) {
+		return fmt.Errorf("status error")
+	}
+
+	return nil
+}
+
+func (w *Watchdog) ping() {
+	if w.check != nil {
+		err := w.check()
+		if err != nil {
+			logger.Errorf("skip systemd watchdog: %s", err.Error())
+			return
+		}
+	}
+
+	err := Notify(StateWatchdog)
+	if err != nil {
+		logger.Errorf("send systemd watchdog error: %s", err.Error())
+	}
+}
+
+func (w *Watchdog) Stop() error {
+	if !w.status.CompareAndSwap(StatusRunning, StatusStopping) {
+		return nil
+	}
+
+	close(w.stopchan)
+
+	w.swg.Wait()
+
+	w.status.CompareAndSwap(StatusStopping, StatusFinished)
+	return nil
+}
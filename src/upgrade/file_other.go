@@ -0,0 +1,13 @@
+//go:build !unix
+
+package upgrade
+
+import (
+	"fmt"
+	"net"
+	"os"
+)
+
+func listenerFile(ln net.Listener) (*os.File, error) {
+	return nil, fmt.Errorf("upgrade is not supported on this platform")
+}
@@ -0,0 +1,40 @@
+//go:build unix
+
+package upgrade
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"syscall"
+)
+
+// listenerFile 复制监听的文件描述符。
+// 不使用 (*net.TCPListener).File，因为启动新进程时对其调用 Fd 会把与旧进程共享的监听设为阻塞模式。
+func listenerFile(ln net.Listener) (*os.File, error) {
+	sc, ok := ln.(syscall.Conn)
+	if !ok {
+		return nil, fmt.Errorf("not a syscall conn")
+	}
+
+	rc, err := sc.SyscallConn()
+	if err != nil {
+		return nil, err
+	}
+
+	var fd int
+	var dupErr error
+	err = rc.Control(func(sysfd uintptr) {
+		fd, dupErr = syscall.Dup(int(sysfd))
+		if dupErr == nil {
+			syscall.CloseOnExec(fd)
+		}
+	})
+	if err != nil {
+		return nil, err
+	} else if dupErr != nil {
+		return nil, dupErr
+	}
+
+	return os.NewFile(uintptr(fd), ln.Addr().String()), nil
+}
@@ -0,0 +1,241 @@
+package upgrade
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	envPID     = "HSW_UPGRADE_PID"      // 旧进程的 PID
+	envFds     = "HSW_UPGRADE_FDS"      // 传入的监听数量，从 3 开始
+	envFdNames = "HSW_UPGRADE_FDNAMES"  // 每个监听对应的转发名称，以 : 分隔
+	envReadyFd = "HSW_UPGRADE_READY_FD" // 新进程启动完成后写入该管道通知旧进程
+)
+
+const listenFdsStart = 3
+
+var parentPID = 0
+var readyFile *os.File = nil
+
+// Listeners 读取旧进程传入的监听，按转发名称分组返回。
+// 读取后会清除相关的环境变量。不是由升级启动时返回空表。
+func Listeners() (map[string][]net.Listener, error) {
+	defer func() {
+		_ = os.Unsetenv(envPID)
+		_ = os.Unsetenv(envFds)
+		_ = os.Unsetenv(envFdNames)
+		_ = os.Unsetenv(envReadyFd)
+	}()
+
+	res := make(map[string][]net.Listener, 4)
+
+	pidStr := os.Getenv(envPID)
+	if pidStr == "" {
+		return res, nil
+	}
+
+	pid, err := strconv.Atoi(pidStr)
+	if err != nil {
+		return nil, fmt.Errorf("bad %s: %s", envPID, pidStr)
+	}
+
+	fds, err := strconv.Atoi(os.Getenv(envFds))
+	if err != nil || fds < 0 {
+		return nil, fmt.Errorf("bad %s: %s", envFds, os.Getenv(envFds))
+	}
+
+	readyFd, err := strconv.Atoi(os.Getenv(envReadyFd))
+	if err != nil || readyFd < listenFdsStart {
+		return nil, fmt.Errorf("bad %s: %s", envReadyFd, os.Getenv(envReadyFd))
+	}
+
+	names := strings.Split(os.Getenv(envFdNames), ":")
+	if len(names) != fds {
+		return nil, fmt.Errorf("bad %s: %s", envFdNames, os.Getenv(envFdNames))
+	}
+
+	for i := 0; i < fds; i++ {
+		file := os.NewFile(uintptr(listenFdsStart+i), names[i])
+
+		ln, err := net.FileListener(file) // 会复制文件描述符
+		_ = file.Close()
+		if err != nil {
+			for _, lns := range res {
+				for _, l := range lns {
+					_ = l.Close()
+				}
+			}
+			return nil, fmt.Errorf("fd %d (%s) is not a listener: %s", listenFdsStart+i, names[i], err.Error())
+		}
+
+		res[names[i]] = append(res[names[i]], ln)
+	}
+
+	parentPID = pid
+	readyFile = os.NewFile(uintptr(readyFd), "upgrade-ready")
+
+	return res, nil
+}
+
+// ParentPID 旧进程的 PID，不是由升级启动时返回 0
+func ParentPID() int {
+	return parentPID
+}
+
+// Ready 通知旧进程新进程已启动完成，旧进程随后停止接受连接。不是由升级启动时不做任何事。
+func Ready() error {
+	if readyFile == nil {
+		return nil
+	}
+
+	defer func() {
+		_ = readyFile.Close()
+		readyFile = nil
+	}()
+
+	_, err := readyFile.Write([]byte{1})
+	return err
+}
+
+// Child 升级时启动的新进程
+type Child struct {
+	cmd   *exec.Cmd
+	ready *os.File
+}
+
+// Exec 使用相同的命令行参数启动当前的可执行文件（可能已被替换为新版本），并将监听传给新进程。
+// 旧进程的监听不受影响，直到新进程启动完成前旧进程仍继续接受连接。
+func Exec(listeners map[string][]net.Listener) (*Child, error) {
+	path, err := os.Executable() // 可执行文件被替换后仍返回原路径
+	if err != nil {
+		return nil, fmt.Errorf("get executable path failed: %s", err.Error())
+	}
+
+	names := make([]string, 0, len(listeners))
+	for name := range listeners {
+		if strings.Contains(name, ":") {
+			return nil, fmt.Errorf("forward name %s contains ':'", name)
+		}
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	files := make([]*os.File, 0, len(listeners))
+	defer func() {
+		for _, f := range files {
+			_ = f.Close()
+		}
+	}()
+
+	fdNames := make([]string, 0, len(listeners))
+	for _, name := range names {
+		for _, ln := range listeners[name] {
+			f, err := listenerFile(ln)
+			if err != nil {
+				return nil, fmt.Errorf("get file of listener %s (%s) failed: %s", ln.Addr().String(), name, err.Error())
+			}
+
+			files = append(files, f)
+			fdNames = append(fdNames, name)
+		}
+	}
+
+	r, w, err := os.Pipe()
+	if err != nil {
+		return nil, fmt.Errorf("create pipe failed: %s", err.Error())
+	}
+	defer func() {
+		_ = w.Close() // 新进程退出时旧进程读取到 EOF
+	}()
+
+	cmd := exec.Command(path, os.Args[1:]...)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	cmd.ExtraFiles = append(append(make([]*os.File, 0, len(files)+1), files...), w)
+	cmd.Env = append(childEnv(),
+		fmt.Sprintf("%s=%d", envPID, os.Getpid()),
+		fmt.Sprintf("%s=%d", envFds, len(files)),
+		fmt.Sprintf("%s=%s", envFdNames, strings.Join(fdNames, ":")),
+		fmt.Sprintf("%s=%d", envReadyFd, listenFdsStart+len(files)))
+
+	err = cmd.Start()
+	if err != nil {
+		_ = r.Close()
+		return nil, fmt.Errorf("start %s failed: %s", path, err.Error())
+	}
+
+	return &Child{
+		cmd:   cmd,
+		ready: r,
+	}, nil
+}
+
+// childEnv 当前的环境变量，去除不应传给新进程的部分
+func childEnv() []string {
+	env := os.Environ()
+	res := make([]string, 0, len(env))
+
+	for _, e := range env {
+		key, _, _ := strings.Cut(e, "=")
+		switch key {
+		case envPID, envFds, envFdNames, envReadyFd, "LISTEN_PID", "LISTEN_FDS", "LISTEN_FDNAMES":
+			continue
+		case "WATCHDOG_PID": // 新进程的 PID 未知，去除后新进程可以继续发送 WATCHDOG=1
+			continue
+		}
+
+		res = append(res, e)
+	}
+
+	return res
+}
+
+func (c *Child) PID() int {
+	return c.cmd.Process.Pid
+}
+
+// WaitReady 等待新进程启动完成，超时或新进程提前退出时结束新进程并返回错误
+func (c *Child) WaitReady(timeout time.Duration) error {
+	defer func() {
+		_ = c.ready.Close()
+	}()
+
+	readychan := make(chan error, 1)
+	go func() {
+		buf := make([]byte, 1)
+		_, err := c.ready.Read(buf)
+		readychan <- err
+	}()
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	select {
+	case err := <-readychan:
+		if err != nil {
+			c.kill()
+			return fmt.Errorf("new process exited before ready")
+		}
+	case <-timer.C:
+		c.kill()
+		return fmt.Errorf("wait for new process ready timeout (%s)", timeout.String())
+	}
+
+	go func() {
+		_ = c.cmd.Wait() // 旧进程仍在等待会话结束时新进程可能退出
+	}()
+
+	return nil
+}
+
+func (c *Child) kill() {
+	_ = c.cmd.Process.Kill()
+	_ = c.cmd.Wait()
+}
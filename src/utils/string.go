@@ -1,6 +1,7 @@
 package utils
 
 import (
+	"fmt"
 	"regexp"
 	"strconv"
 	"strings"
@@ -366,6 +367,22 @@ func ReadBytes(str string) uint64 {
 	return num
 }
 
+func FormatBytes(n int64) string {
+	const unit = 1024
+
+	if n < unit {
+		return fmt.Sprintf("%dB", n)
+	}
+
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+
+	return fmt.Sprintf("%.2f%cB", float64(n)/float64(div), "KMGTPE"[exp])
+}
+
 func StringOrDefault(str string, defaultString string) string {
 	str = strings.TrimSpace(str)
 	if str == "" {